@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"sync"
+	"time"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+type breakerStatus struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            string `json:"opened_at,omitempty"`
+	RetryAt             string `json:"retry_at,omitempty"`
+}
+
+// circuitBreaker stops calling its source after a number of consecutive failures, so a source that is down is not hammered on every check.
+// Once the cool-down is over, a single trial call is let through (half-open): its success closes the breaker, its failure opens it again.
+// Only transport errors and 5xx responses count as failures, any other response shows that the source is up.
+type circuitBreaker struct {
+	source    TransactionSource
+	threshold int
+	coolDown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+	sync.Mutex
+}
+
+func newCircuitBreaker(source TransactionSource, threshold int, coolDown time.Duration) *circuitBreaker {
+	return &circuitBreaker{source: source, threshold: threshold, coolDown: coolDown, state: breakerClosed, now: time.Now}
+}
+
+func (cb *circuitBreaker) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	txs, err := cb.source.FetchOpenTransactions(ctx, contentType, earliestTime, latestTime)
+	cb.record(err)
+	return txs, err
+}
+
+// fetchWithRetries lets a whole retried fetch through, or none of it, and records its final outcome only,
+// so that the retries of a single check do not trip the breaker by themselves.
+func (cb *circuitBreaker) fetchWithRetries(ctx context.Context, p retryPolicy, ct contentTypeConfig) (transactions, []fetchAttempt, error) {
+
+	if err := cb.allow(); err != nil {
+		return nil, nil, err
+	}
+
+	txs, attempts, err := p.fetchAttempts(ctx, cb.source, ct)
+	cb.record(err)
+	return txs, attempts, err
+}
+
+func (cb *circuitBreaker) allow() error {
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.coolDown {
+			return &fetchError{reason: failureReasonCircuitOpen, err: fmt.Errorf("circuit breaker is open until %s", cb.openedAt.Add(cb.coolDown).Format(timestampFormat))}
+		}
+		cb.state = breakerHalfOpen
+		logger.Infof("Circuit breaker is half-open, letting a trial call through.")
+		return nil
+	case breakerHalfOpen:
+		return &fetchError{reason: failureReasonCircuitOpen, err: fmt.Errorf("circuit breaker is half-open, waiting for the trial call")}
+	default:
+		return nil
+	}
+}
+
+func (cb *circuitBreaker) record(err error) {
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	if err == nil || !isRetryable(err) {
+		if cb.state != breakerClosed {
+			logger.Infof("Circuit breaker is closed, the trial call went through.")
+		}
+		cb.state = breakerClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == breakerHalfOpen || (cb.state == breakerClosed && cb.failures >= cb.threshold) {
+		cb.state = breakerOpen
+		cb.openedAt = cb.now()
+		logger.Warnf("Circuit breaker is open after %d consecutive failures, calls are suspended for %v.", cb.failures, cb.coolDown)
+	}
+}
+
+func (cb *circuitBreaker) status() breakerStatus {
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	status := breakerStatus{State: cb.state, ConsecutiveFailures: cb.failures}
+	if cb.state != breakerClosed {
+		status.OpenedAt = cb.openedAt.Format(timestampFormat)
+		status.RetryAt = cb.openedAt.Add(cb.coolDown).Format(timestampFormat)
+	}
+	return status
+}
+
+func (s breakerStatus) String() string {
+	switch s.State {
+	case breakerOpen:
+		return fmt.Sprintf("Circuit breaker is open since %s after %d consecutive failures, calls are suspended until %s.", s.OpenedAt, s.ConsecutiveFailures, s.RetryAt)
+	case breakerHalfOpen:
+		return fmt.Sprintf("Circuit breaker is half-open after %d consecutive failures, a trial call is in progress.", s.ConsecutiveFailures)
+	default:
+		return fmt.Sprintf("Circuit breaker is closed with %d consecutive failures.", s.ConsecutiveFailures)
+	}
+}
+
+// suspends tells whether a call made at the given time would be refused without calling the source.
+func (cb *circuitBreaker) suspends(at time.Time) bool {
+
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.state == breakerOpen && at.Sub(cb.openedAt) < cb.coolDown
+}
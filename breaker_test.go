@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func fetchThrough(cb *circuitBreaker) error {
+	_, err := cb.FetchOpenTransactions(context.Background(), "annotations", annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+	return err
+}
+
+func TestCircuitBreaker_Trips(t *testing.T) {
+
+	hook := logger.NewTestHook("healthchecker-test")
+	now := time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC)
+	source := &scriptedSource{errs: []error{transportErr, status503Err, transportErr}}
+	cb := newCircuitBreaker(source, 3, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	assert.Equal(t, transportErr, fetchThrough(cb))
+	assert.Equal(t, status503Err, fetchThrough(cb))
+	assert.Equal(t, breakerStatus{State: breakerClosed, ConsecutiveFailures: 2}, cb.status())
+
+	assert.Equal(t, transportErr, fetchThrough(cb))
+	assert.Equal(t, "Circuit breaker is open after 3 consecutive failures, calls are suspended for 1m0s.", hook.LastEntry().Message)
+	assert.Equal(t, breakerStatus{State: breakerOpen, ConsecutiveFailures: 3, OpenedAt: "2018-01-15T14:00:00Z", RetryAt: "2018-01-15T14:01:00Z"}, cb.status())
+
+	// the source is not called while the breaker is open
+	now = now.Add(59 * time.Second)
+	err := fetchThrough(cb)
+	assert.Equal(t, failureReasonCircuitOpen, failureReasonOf(err))
+	assert.Equal(t, "failed to retrieve transactions: circuit breaker is open until 2018-01-15T14:01:00Z", err.Error())
+	assert.False(t, isRetryable(err))
+	assert.Equal(t, 3, source.calls)
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	now := time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC)
+	source := &scriptedSource{errs: []error{transportErr, transportErr}}
+	cb := newCircuitBreaker(source, 1, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	assert.Equal(t, transportErr, fetchThrough(cb))
+	assert.Equal(t, breakerOpen, cb.status().State)
+
+	// the trial call fails, so the breaker opens again for a whole cool-down
+	now = now.Add(time.Minute)
+	assert.Equal(t, transportErr, fetchThrough(cb))
+	assert.Equal(t, breakerStatus{State: breakerOpen, ConsecutiveFailures: 2, OpenedAt: "2018-01-15T14:01:00Z", RetryAt: "2018-01-15T14:02:00Z"}, cb.status())
+	assert.Equal(t, failureReasonCircuitOpen, failureReasonOf(fetchThrough(cb)))
+
+	// the trial call succeeds
+	now = now.Add(time.Minute)
+	assert.Nil(t, fetchThrough(cb))
+	assert.Equal(t, breakerStatus{State: breakerClosed}, cb.status())
+	assert.Equal(t, 3, source.calls)
+}
+
+func TestCircuitBreaker_SingleTrialCall(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	release := make(chan struct{})
+	source := &fakeSource{errs: map[string]error{"annotations": transportErr}}
+	cb := newCircuitBreaker(source, 1, 0)
+
+	assert.Equal(t, transportErr, fetchThrough(cb))
+
+	source.release = release
+	done := make(chan error)
+	go func() {
+		done <- fetchThrough(cb)
+	}()
+
+	for i := 0; i < 100 && cb.status().State != breakerHalfOpen; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	err := fetchThrough(cb)
+	assert.Equal(t, failureReasonCircuitOpen, failureReasonOf(err))
+	assert.Contains(t, err.Error(), "circuit breaker is half-open")
+
+	close(release)
+	assert.Equal(t, transportErr, <-done)
+}
+
+func TestCircuitBreaker_ResponsesResetFailures(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &scriptedSource{errs: []error{transportErr, status404Err, transportErr, decodeErr, errors.New("backend is down"), transportErr}}
+	cb := newCircuitBreaker(source, 2, time.Minute)
+
+	for i := 0; i < 6; i++ {
+		fetchThrough(cb)
+		assert.Equal(t, breakerClosed, cb.status().State)
+	}
+	assert.Equal(t, 1, cb.status().ConsecutiveFailures)
+}
+
+func TestBreakerStatus_String(t *testing.T) {
+	assert.Equal(t, "Circuit breaker is closed with 1 consecutive failures.", breakerStatus{State: breakerClosed, ConsecutiveFailures: 1}.String())
+	assert.Equal(t, "Circuit breaker is open since 2018-01-15T14:00:00Z after 5 consecutive failures, calls are suspended until 2018-01-15T14:02:00Z.",
+		breakerStatus{State: breakerOpen, ConsecutiveFailures: 5, OpenedAt: "2018-01-15T14:00:00Z", RetryAt: "2018-01-15T14:02:00Z"}.String())
+	assert.Equal(t, "Circuit breaker is half-open after 5 consecutive failures, a trial call is in progress.", breakerStatus{State: breakerHalfOpen, ConsecutiveFailures: 5}.String())
+}
+
+func TestDetermineHealthStatuses_CircuitBreakerOpen(t *testing.T) {
+
+	hook := logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{errs: map[string]error{"annotations": transportErr}}
+	cb := newCircuitBreaker(source, 1, time.Minute)
+	service := healthcheckerService{source: cb, breaker: cb, contentTypes: []contentTypeConfig{annotationsConfig}}
+
+	service.refreshHealthStatuses()
+	status := service.getContentTypeHealthStatus("annotations")
+	assert.Equal(t, breakerOpen, status.CircuitBreaker.State)
+	assert.Equal(t, transportErr.Error(), status.Error)
+
+	service.refreshHealthStatuses()
+	status = service.getContentTypeHealthStatus("annotations")
+	assert.False(t, status.Successful)
+	assert.Equal(t, failureReasonCircuitOpen, status.failureReason)
+	assert.Equal(t, "warning", hook.LastEntry().Level.String())
+	assert.Contains(t, hook.LastEntry().Message, "Skipped retrieving annotations transactions: failed to retrieve transactions: circuit breaker is open until")
+	assert.Len(t, source.calls, 1)
+}
+
+func TestCircuitBreaker_CountsOneOutcomePerFetch(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &scriptedSource{errs: []error{transportErr, status503Err, transportErr, transportErr, transportErr, transportErr}}
+	cb := newCircuitBreaker(source, 2, time.Minute)
+	policy := retryPolicy{retries: 2, jitter: noJitter}
+
+	_, attempts, err := policy.fetch(context.Background(), cb, annotationsConfig)
+	assert.Equal(t, transportErr, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, breakerStatus{State: breakerClosed, ConsecutiveFailures: 1}, cb.status(), "the retries of a fetch are a single failure")
+
+	_, _, err = policy.fetch(context.Background(), cb, annotationsConfig)
+	assert.Equal(t, transportErr, err)
+	assert.Equal(t, breakerOpen, cb.status().State)
+	assert.Equal(t, 6, source.calls)
+
+	_, attempts, err = policy.fetch(context.Background(), cb, annotationsConfig)
+	assert.Equal(t, failureReasonCircuitOpen, failureReasonOf(err))
+	assert.Equal(t, 0, attempts)
+	assert.Equal(t, 6, source.calls)
+}
+
+func TestCircuitBreaker_BypassedByQueries(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{errs: map[string]error{"annotations": transportErr}}
+	service := newQueryService(source)
+	service.breaker = newCircuitBreaker(source, 1, time.Minute)
+
+	service.determineHealthStatuses()
+	assert.Equal(t, breakerOpen, service.breaker.status().State)
+
+	// the queries still call the source while the breaker is open, and their failures do not count
+	_, err := service.query(context.Background(), transactionQuery{ContentType: "annotations"})
+	assert.Equal(t, transportErr, err)
+	assert.Len(t, source.calls, 2)
+	assert.Equal(t, 1, service.breaker.status().ConsecutiveFailures)
+}
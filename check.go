@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"sync"
+	"time"
+)
+
+// checkRun is a check in progress, done is closed once its results are in the cache.
+// A check started on demand is fresh enough for the other on-demand callers, a scheduled one may have started before them.
+type checkRun struct {
+	done     chan struct{}
+	onDemand bool
+}
+
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("too many on-demand checks, retry in %d seconds", e.retryAfterSeconds())
+}
+
+// retryAfterSeconds rounds the wait up to whole seconds, as used by the Retry-After header.
+func (e *rateLimitError) retryAfterSeconds() int {
+	return int((e.retryAfter + time.Second - 1) / time.Second)
+}
+
+// newRun registers a new check run, unless one is already running, which is returned instead. It should be called with runLock held.
+func (s *healthcheckerService) newRun(onDemand bool) (*checkRun, bool) {
+	if s.running != nil {
+		return s.running, false
+	}
+	s.running = &checkRun{done: make(chan struct{}), onDemand: onDemand}
+	return s.running, true
+}
+
+// run determines the health statuses without holding the lock, then swaps them into the cache at once.
+func (s *healthcheckerService) run(run *checkRun) {
+
+	defer func() {
+		s.runLock.Lock()
+		s.running = nil
+		s.runLock.Unlock()
+		close(run.done)
+	}()
+
+	statuses := s.determineHealthStatuses()
+
+	s.Lock()
+	s.healthStatuses = statuses
+	s.Unlock()
+
+	if s.history != nil {
+		s.history.add(s.clock(), statuses)
+	}
+	if s.notifications != nil {
+		s.notifications.observe(s.contentTypes, statuses)
+	}
+}
+
+// checkNow runs a check on demand and returns the refreshed health statuses.
+// Callers arriving while an on-demand check is running wait for that one instead of starting another.
+// A scheduled check may have fetched its results before the call, so it is waited for and followed by a check of their own.
+// Only the checks actually started count against the rate limit.
+func (s *healthcheckerService) checkNow() (interface{}, error) {
+
+	for {
+		s.runLock.Lock()
+		run, started := s.newRun(true)
+		if started && s.checkLimiter != nil {
+			if wait := s.checkLimiter.reserve(time.Now()); wait > 0 {
+				s.running = nil
+				s.runLock.Unlock()
+				return nil, &rateLimitError{retryAfter: wait}
+			}
+		}
+		s.runLock.Unlock()
+
+		if started {
+			logger.Infof("Running an on-demand health check.")
+			s.run(run)
+			break
+		}
+		<-run.done
+		if run.onDemand {
+			break
+		}
+	}
+
+	return s.getHealthStatus(), nil
+}
+
+// rateLimiter allows at most limit calls in any sliding window.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	calls  []time.Time
+	sync.Mutex
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window}
+}
+
+// reserve records a call at the given time if the limit allows it, otherwise it returns how long to wait before the next call is allowed.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+
+	l.Lock()
+	defer l.Unlock()
+
+	for len(l.calls) > 0 && !now.Before(l.calls[0].Add(l.window)) {
+		l.calls = l.calls[1:]
+	}
+
+	if len(l.calls) >= l.limit {
+		return l.calls[0].Add(l.window).Sub(now)
+	}
+
+	l.calls = append(l.calls, now)
+	return 0
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCheckNow(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{txs: map[string]transactions{"annotations": testTxs}}
+	service := &healthcheckerService{
+		source:         source,
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{},
+		history:        newHealthHistory(5, 0),
+	}
+
+	statuses, err := service.checkNow()
+	assert.NoError(t, err)
+	assert.Equal(t, testTxs, statuses.(map[string]healthStatus)["annotations"].OpenTransactions)
+	assert.Equal(t, testTxs, service.getContentTypeHealthStatus("annotations").OpenTransactions)
+	assert.Len(t, service.history.query(time.Time{}, time.Time{}, 0), 1)
+	assert.Len(t, source.calls, 1)
+	assert.False(t, isRunning(service))
+}
+
+func TestCheckNow_Coalesces(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	release := make(chan struct{})
+	source := &fakeSource{release: release}
+	service := &healthcheckerService{
+		source:         source,
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{},
+		checkLimiter:   newRateLimiter(1, time.Minute),
+	}
+
+	results := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := service.checkNow()
+			results <- err
+		}()
+	}
+
+	for i := 0; i < 100 && !isRunning(service); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// give the other callers the time to join the running check
+	time.Sleep(50 * time.Millisecond)
+
+	// the ticker does not start another check either
+	assert.False(t, service.refreshHealthStatuses())
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, <-results)
+	}
+	assert.Len(t, source.calls, 1)
+
+	// the limit of one check a minute is used up
+	_, err := service.checkNow()
+	assert.IsType(t, &rateLimitError{}, err)
+	assert.Len(t, source.calls, 1)
+	assert.False(t, isRunning(service))
+
+	// the ticker is not rate limited
+	assert.True(t, service.refreshHealthStatuses())
+	assert.Len(t, source.calls, 2)
+}
+
+func TestCheckNow_DoesNotCoalesceOntoAScheduledCheck(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	release := make(chan struct{})
+	source := &fakeSource{release: release}
+	service := &healthcheckerService{
+		source:         source,
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{},
+	}
+
+	scheduled := make(chan bool)
+	go func() {
+		scheduled <- service.refreshHealthStatuses()
+	}()
+	for i := 0; i < 100 && !isRunning(service); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	results := make(chan error)
+	go func() {
+		_, err := service.checkNow()
+		results <- err
+	}()
+	// give the on-demand check the time to find the scheduled one running
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	assert.True(t, <-scheduled)
+	assert.NoError(t, <-results)
+	assert.Len(t, source.calls, 2, "the on-demand check runs after the scheduled one")
+	assert.False(t, isRunning(service))
+}
+
+func TestRateLimiter(t *testing.T) {
+
+	now := time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, time.Minute)
+
+	assert.Equal(t, time.Duration(0), limiter.reserve(now))
+	assert.Equal(t, time.Duration(0), limiter.reserve(now.Add(20*time.Second)))
+	assert.Equal(t, 30*time.Second, limiter.reserve(now.Add(30*time.Second)))
+	assert.Equal(t, time.Duration(0), limiter.reserve(now.Add(time.Minute)))
+	assert.Equal(t, 20*time.Second, limiter.reserve(now.Add(time.Minute)))
+	assert.Equal(t, time.Duration(0), limiter.reserve(now.Add(80*time.Second)))
+}
+
+func TestRateLimitError(t *testing.T) {
+	assert.EqualError(t, &rateLimitError{retryAfter: 29500 * time.Millisecond}, "too many on-demand checks, retry in 30 seconds")
+	assert.Equal(t, 30, (&rateLimitError{retryAfter: 30 * time.Second}).retryAfterSeconds())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	checkFormatTable = "table"
+	checkFormatJSON  = "json"
+)
+
+// exit codes of the check command
+const (
+	exitHealthy     = 0
+	exitDegraded    = 1
+	exitUnreachable = 2
+	exitCheckError  = 3
+)
+
+const (
+	outcomeHealthy     = "healthy"
+	outcomeDegraded    = "degraded"
+	outcomeUnreachable = "unreachable"
+)
+
+type checkOutcome struct {
+	ContentType string `json:"content_type"`
+	Outcome     string `json:"status"`
+	Tier        string `json:"tier,omitempty"`
+	healthStatus
+}
+
+type checkReport struct {
+	Outcome      string         `json:"status"`
+	ContentTypes []checkOutcome `json:"content_types"`
+}
+
+// runCheckCommand runs a single check of every content type, prints the results in the given format and returns the exit code.
+func runCheckCommand(s *healthcheckerService, format string, out io.Writer) int {
+
+	statuses := s.determineHealthStatuses()
+	report := checkReport{Outcome: outcomeHealthy, ContentTypes: []checkOutcome{}}
+	for _, ct := range s.contentTypes {
+		outcome := evaluateCheck(ct, statuses[ct.ContentType])
+		report.ContentTypes = append(report.ContentTypes, outcome)
+		if outcomeExitCode(outcome.Outcome) > outcomeExitCode(report.Outcome) {
+			report.Outcome = outcome.Outcome
+		}
+	}
+
+	var err error
+	if format == checkFormatJSON {
+		err = writeCheckJSON(out, report)
+	} else {
+		err = writeCheckTable(out, report)
+	}
+	if err != nil {
+		return exitCheckError
+	}
+
+	return outcomeExitCode(report.Outcome)
+}
+
+func evaluateCheck(ct contentTypeConfig, status healthStatus) checkOutcome {
+
+	outcome := checkOutcome{ContentType: ct.ContentType, Outcome: outcomeHealthy, healthStatus: status}
+	if !status.Successful {
+		outcome.Outcome = outcomeUnreachable
+		return outcome
+	}
+
+	if reached := ct.reachedTier(len(status.OpenTransactions)); reached >= 0 {
+		outcome.Outcome = outcomeDegraded
+		outcome.Tier = ct.failureTiers()[reached].Name
+	}
+	return outcome
+}
+
+func outcomeExitCode(outcome string) int {
+	switch outcome {
+	case outcomeUnreachable:
+		return exitUnreachable
+	case outcomeDegraded:
+		return exitDegraded
+	default:
+		return exitHealthy
+	}
+}
+
+func writeCheckJSON(out io.Writer, report checkReport) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func writeCheckTable(out io.Writer, report checkReport) error {
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "CONTENT TYPE\tSTATUS\tFAILED\tCHECKING PERIOD\tDETAILS")
+	for _, outcome := range report.ContentTypes {
+		details := "-"
+		if outcome.Error != "" {
+			details = outcome.Error
+		} else if outcome.Tier != "" {
+			details = fmt.Sprintf("%s tier", outcome.Tier)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", outcome.ContentType, outcome.Outcome, len(outcome.OpenTransactions), outcome.CheckingPeriod, details)
+	}
+
+	failed := false
+	for _, outcome := range report.ContentTypes {
+		for _, tx := range outcome.OpenTransactions {
+			if !failed {
+				fmt.Fprintln(w, "\nCONTENT TYPE\tTRANSACTION ID\tUUID\tSTART TIME")
+				failed = true
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", outcome.ContentType, tx.TransactionID, tx.UUID, tx.LastModified)
+		}
+	}
+
+	fmt.Fprintf(w, "\nOverall status: %s\n", report.Outcome)
+	return w.Flush()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newCheckCommandService(source TransactionSource) *healthcheckerService {
+	return &healthcheckerService{
+		source: source,
+		contentTypes: []contentTypeConfig{
+			annotationsConfig,
+			{ContentType: "lists", EarliestTime: annotationsConfig.EarliestTime, LatestTime: annotationsConfig.LatestTime,
+				FailureTiers: []failureTier{{Name: "warning", Threshold: 1, Severity: 2}, {Name: "critical", Threshold: 5, Severity: 1}}},
+		},
+		healthStatuses: map[string]healthStatus{},
+	}
+}
+
+func TestRunCheckCommand_ExitCodes(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+
+	var tests = []struct {
+		scenario string
+		source   *fakeSource
+		exitCode int
+		status   string
+	}{
+		{"Healthy", &fakeSource{}, exitHealthy, outcomeHealthy},
+		{"Below the threshold", &fakeSource{txs: map[string]transactions{"annotations": testTxs[:1]}}, exitHealthy, outcomeHealthy},
+		{"Degraded", &fakeSource{txs: map[string]transactions{"annotations": testTxs}}, exitDegraded, outcomeDegraded},
+		{"Degraded tier", &fakeSource{txs: map[string]transactions{"lists": testTxs[:1]}}, exitDegraded, outcomeDegraded},
+		{"Unreachable", &fakeSource{errs: map[string]error{"annotations": transportErr}}, exitUnreachable, outcomeUnreachable},
+		{"Unreachable wins over degraded", &fakeSource{txs: map[string]transactions{"lists": testTxs}, errs: map[string]error{"annotations": status503Err}}, exitUnreachable, outcomeUnreachable},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		exitCode := runCheckCommand(newCheckCommandService(test.source), checkFormatJSON, &out)
+
+		assert.Equal(t, test.exitCode, exitCode, test.scenario)
+
+		var report map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(out.Bytes(), &report), test.scenario) {
+			assert.Equal(t, test.status, report["status"], test.scenario)
+		}
+	}
+}
+
+func TestRunCheckCommand_JSON(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{txs: map[string]transactions{"lists": testTxs[:1]}, errs: map[string]error{"annotations": status503Err}}
+
+	var out bytes.Buffer
+	runCheckCommand(newCheckCommandService(source), checkFormatJSON, &out)
+
+	var report struct {
+		Status       string `json:"status"`
+		ContentTypes []struct {
+			ContentType        string        `json:"content_type"`
+			Status             string        `json:"status"`
+			Tier               string        `json:"tier"`
+			FailedTransactions []transaction `json:"failed_transactions"`
+			Error              string        `json:"event_reader_error"`
+		} `json:"content_types"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+
+	assert.Equal(t, outcomeUnreachable, report.Status)
+	assert.Len(t, report.ContentTypes, 2)
+	assert.Equal(t, "annotations", report.ContentTypes[0].ContentType)
+	assert.Equal(t, outcomeUnreachable, report.ContentTypes[0].Status)
+	assert.Equal(t, "failed to retrieve transactions: unexpected status code 503", report.ContentTypes[0].Error)
+	assert.Equal(t, "lists", report.ContentTypes[1].ContentType)
+	assert.Equal(t, outcomeDegraded, report.ContentTypes[1].Status)
+	assert.Equal(t, "warning", report.ContentTypes[1].Tier)
+	assert.Equal(t, testTxs[:1], report.ContentTypes[1].FailedTransactions)
+}
+
+func TestRunCheckCommand_Table(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{txs: map[string]transactions{"annotations": testTxs, "lists": testTxs[1:]}}
+
+	var out bytes.Buffer
+	exitCode := runCheckCommand(newCheckCommandService(source), checkFormatTable, &out)
+
+	assert.Equal(t, exitDegraded, exitCode)
+	assert.Equal(t, `CONTENT TYPE  STATUS    FAILED  CHECKING PERIOD       DETAILS
+annotations   degraded  2       Between -15m and -5m  -
+lists         degraded  1       Between -15m and -5m  warning tier
+
+CONTENT TYPE  TRANSACTION ID  UUID   START TIME
+annotations   tid1            uuid1  2017-10-16T14:00:00.000Z
+annotations   tid2            uuid2  2017-10-16T16:00:00.000Z
+lists         tid2            uuid2  2017-10-16T16:00:00.000Z
+
+Overall status: degraded
+`, out.String())
+}
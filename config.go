@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const (
+	defaultContentTypes     = `[{"contentType":"annotations"}]`
+	defaultFailureThreshold = 2
+)
+
+// parseContentTypes reads the JSON list of monitored content types.
+// Missing windows and thresholds fall back to the given defaults, and every resulting window is validated.
+func parseContentTypes(value string, defaults contentTypeConfig) ([]contentTypeConfig, error) {
+
+	var configs []contentTypeConfig
+	if err := json.Unmarshal([]byte(value), &configs); err != nil {
+		return nil, fmt.Errorf("content types configuration is not valid JSON: %v", err)
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one content type should be configured")
+	}
+
+	seen := map[string]bool{}
+	for i := range configs {
+		ct := &configs[i]
+		if ct.ContentType == "" {
+			return nil, fmt.Errorf("content type at position %d has no name", i)
+		}
+		if seen[ct.ContentType] {
+			return nil, fmt.Errorf("content type %s is configured more than once", ct.ContentType)
+		}
+		seen[ct.ContentType] = true
+
+		if !ct.EarliestTime.isSet() {
+			ct.EarliestTime = defaults.EarliestTime
+		}
+		if !ct.LatestTime.isSet() {
+			ct.LatestTime = defaults.LatestTime
+		}
+		if ct.SLAWindow == 0 {
+			ct.SLAWindow = defaults.SLAWindow
+		}
+		if len(ct.FailureTiers) == 0 && ct.FailureThreshold == 0 {
+			ct.FailureTiers = defaults.FailureTiers
+		}
+		if ct.FailureThreshold == 0 {
+			ct.FailureThreshold = defaults.FailureThreshold
+		}
+		if ct.SLAWindow < 0 || ct.FailureThreshold < 0 {
+			return nil, fmt.Errorf("content type %s has a negative SLA window or failure threshold", ct.ContentType)
+		}
+		if err := validateRecurringWindow(ct.EarliestTime, ct.LatestTime); err != nil {
+			return nil, fmt.Errorf("content type %s has an invalid checking window: %v", ct.ContentType, err)
+		}
+		tiers, err := validateFailureTiers(ct.FailureTiers)
+		if err != nil {
+			return nil, fmt.Errorf("content type %s has invalid failure tiers: %v", ct.ContentType, err)
+		}
+		ct.FailureTiers = tiers
+	}
+
+	return configs, nil
+}
+
+// parseFailureTiers reads the JSON list of the default failure tiers. An empty value means no tiers,
+// in which case every content type is checked against its single failure threshold.
+func parseFailureTiers(value string) ([]failureTier, error) {
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var tiers []failureTier
+	if err := json.Unmarshal([]byte(value), &tiers); err != nil {
+		return nil, fmt.Errorf("failure tiers configuration is not valid JSON: %v", err)
+	}
+
+	return validateFailureTiers(tiers)
+}
+
+// validateFailureTiers orders the tiers by threshold and checks that a higher threshold never means a lower severity.
+func validateFailureTiers(tiers []failureTier) ([]failureTier, error) {
+
+	if len(tiers) == 0 {
+		return tiers, nil
+	}
+
+	sorted := make([]failureTier, len(tiers))
+	copy(sorted, tiers)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Threshold < sorted[j].Threshold })
+
+	names := map[string]bool{}
+	for i, tier := range sorted {
+		if tier.Name == "" && len(sorted) > 1 {
+			return nil, fmt.Errorf("every tier needs a name when more than one tier is configured")
+		}
+		if names[tier.Name] {
+			return nil, fmt.Errorf("tier %s is configured more than once", tier.Name)
+		}
+		names[tier.Name] = true
+
+		if tier.Threshold < 1 {
+			return nil, fmt.Errorf("tier %s should have a threshold of at least 1", tier.Name)
+		}
+		if tier.Severity < 1 || tier.Severity > 3 {
+			return nil, fmt.Errorf("tier %s should have a severity between 1 and 3", tier.Name)
+		}
+		if i > 0 {
+			previous := sorted[i-1]
+			if previous.Threshold == tier.Threshold {
+				return nil, fmt.Errorf("tiers %s and %s have the same threshold", previous.Name, tier.Name)
+			}
+			if previous.Severity < tier.Severity {
+				return nil, fmt.Errorf("tier %s has a higher threshold but a lower severity than tier %s", tier.Name, previous.Name)
+			}
+		}
+	}
+
+	return sorted, nil
+}
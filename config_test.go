@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testDefaults = contentTypeConfig{
+	EarliestTime:     mustParseRelativeTime(earliestTime),
+	LatestTime:       mustParseRelativeTime(latestTime),
+	SLAWindow:        2,
+	FailureThreshold: defaultFailureThreshold,
+}
+
+func TestParseContentTypes_Defaults(t *testing.T) {
+
+	configs, err := parseContentTypes(defaultContentTypes, testDefaults)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []contentTypeConfig{
+		{ContentType: "annotations", EarliestTime: testDefaults.EarliestTime, LatestTime: testDefaults.LatestTime, SLAWindow: 2, FailureThreshold: defaultFailureThreshold},
+	}, configs)
+}
+
+func TestParseContentTypes_Overrides(t *testing.T) {
+
+	configs, err := parseContentTypes(`[
+		{"contentType":"annotations"},
+		{"contentType":"lists","earliestTime":"-30m","latestTime":"-10m","slaWindow":5,"failureThreshold":1}
+	]`, testDefaults)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []contentTypeConfig{
+		{ContentType: "annotations", EarliestTime: testDefaults.EarliestTime, LatestTime: testDefaults.LatestTime, SLAWindow: 2, FailureThreshold: defaultFailureThreshold},
+		{ContentType: "lists", EarliestTime: mustParseRelativeTime("-30m"), LatestTime: mustParseRelativeTime("-10m"), SLAWindow: 5, FailureThreshold: 1},
+	}, configs)
+}
+
+func TestParseContentTypes_Invalid(t *testing.T) {
+
+	var tests = []struct {
+		scenario string
+		value    string
+		err      string
+	}{
+		{"Not JSON", `annotations`, "content types configuration is not valid JSON"},
+		{"Empty list", `[]`, "at least one content type should be configured"},
+		{"Missing name", `[{"slaWindow":2}]`, "content type at position 0 has no name"},
+		{"Duplicate", `[{"contentType":"lists"},{"contentType":"lists"}]`, "content type lists is configured more than once"},
+		{"Negative threshold", `[{"contentType":"lists","failureThreshold":-1}]`, "content type lists has a negative SLA window or failure threshold"},
+		{"Unparsable window", `[{"contentType":"lists","earliestTime":"15 minutes ago"}]`, "is not a valid relative time"},
+		{"Absolute window", `[{"contentType":"lists","latestTime":"2017-12-19T09:00:00Z"}]`, `"2017-12-19T09:00:00Z" is not a valid relative time`},
+		{"Empty window", `[{"contentType":"lists","earliestTime":"-5m","latestTime":"-15m"}]`, "content type lists has an invalid checking window: earliest time -5m should be before latest time -15m"},
+		{"Window in the future", `[{"contentType":"lists","latestTime":"+5m"}]`, "latest time +5m should not be in the future"},
+		{"Window empty at some times", `[{"contentType":"lists","earliestTime":"@h"}]`, "content type lists has an invalid checking window: earliest time @h should be before latest time -5m when checked at 00:00:00"},
+		{"Invalid tiers", `[{"contentType":"lists","failureTiers":[{"name":"warning","threshold":1,"severity":4}]}]`, "content type lists has invalid failure tiers: tier warning should have a severity between 1 and 3"},
+	}
+
+	for _, test := range tests {
+		_, err := parseContentTypes(test.value, testDefaults)
+		if assert.Error(t, err, test.scenario) {
+			assert.Contains(t, err.Error(), test.err, test.scenario)
+		}
+	}
+}
+
+func TestParseContentTypes_FailureTiers(t *testing.T) {
+
+	defaults := testDefaults
+	defaults.FailureTiers = []failureTier{{Name: "warning", Threshold: 1, Severity: 2}, {Name: "critical", Threshold: 10, Severity: 1}}
+
+	configs, err := parseContentTypes(`[
+		{"contentType":"annotations"},
+		{"contentType":"content","failureThreshold":3},
+		{"contentType":"lists","failureTiers":[{"name":"critical","threshold":5,"severity":1},{"name":"warning","threshold":2,"severity":3}]}
+	]`, defaults)
+
+	assert.NoError(t, err)
+	assert.Equal(t, defaults.FailureTiers, configs[0].FailureTiers, "global tiers are used by default")
+	assert.Empty(t, configs[1].FailureTiers, "an explicit threshold takes precedence over the global tiers")
+	assert.Equal(t, 3, configs[1].FailureThreshold)
+	assert.Equal(t, []failureTier{{Name: "warning", Threshold: 2, Severity: 3}, {Name: "critical", Threshold: 5, Severity: 1}}, configs[2].FailureTiers, "tiers are ordered by threshold")
+}
+
+func TestParseFailureTiers(t *testing.T) {
+
+	tiers, err := parseFailureTiers("")
+	assert.NoError(t, err)
+	assert.Empty(t, tiers)
+
+	tiers, err = parseFailureTiers(`[{"name":"critical","threshold":20,"severity":1},{"name":"warning","threshold":1,"severity":2}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []failureTier{{Name: "warning", Threshold: 1, Severity: 2}, {Name: "critical", Threshold: 20, Severity: 1}}, tiers)
+
+	var tests = []struct {
+		scenario string
+		value    string
+		err      string
+	}{
+		{"Not JSON", `warning`, "failure tiers configuration is not valid JSON"},
+		{"Unnamed", `[{"threshold":1,"severity":2},{"name":"critical","threshold":2,"severity":1}]`, "every tier needs a name when more than one tier is configured"},
+		{"Duplicate", `[{"name":"a","threshold":1,"severity":2},{"name":"a","threshold":2,"severity":1}]`, "tier a is configured more than once"},
+		{"Zero threshold", `[{"name":"a","threshold":0,"severity":2}]`, "tier a should have a threshold of at least 1"},
+		{"Same threshold", `[{"name":"a","threshold":1,"severity":2},{"name":"b","threshold":1,"severity":1}]`, "tiers a and b have the same threshold"},
+		{"Less severe", `[{"name":"a","threshold":1,"severity":1},{"name":"b","threshold":2,"severity":2}]`, "tier b has a higher threshold but a lower severity than tier a"},
+	}
+
+	for _, test := range tests {
+		_, err := parseFailureTiers(test.value)
+		if assert.Error(t, err, test.scenario) {
+			assert.Contains(t, err.Error(), test.err, test.scenario)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// eventReaderSource fetches the open transactions from the splunk-event-reader.
+type eventReaderSource struct {
+	address string
+	client  *http.Client
+}
+
+func newEventReaderSource(address string, client *http.Client) *eventReaderSource {
+	return &eventReaderSource{address: address, client: client}
+}
+
+func (s *eventReaderSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+
+	req, err := http.NewRequest("GET", s.address+"/"+contentType+"/transactions", nil)
+	if err != nil {
+		return nil, &fetchError{reason: failureReasonRequest, location: s.address, err: err}
+	}
+
+	q := req.URL.Query()
+	q.Add(earliestTimePathVar, earliestTime.splunkValue())
+	q.Add(latestTimePathVar, latestTime.splunkValue())
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, &fetchError{reason: failureReasonTransport, location: req.URL.String(), err: err}
+	}
+	defer cleanUp(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetchError{reason: failureReasonStatus, location: req.URL.String(), statusCode: resp.StatusCode, err: fmt.Errorf("unexpected status code %d", resp.StatusCode)}
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &fetchError{reason: failureReasonRead, location: req.URL.String(), err: err}
+	}
+
+	var txs transactions
+	if err := json.Unmarshal(b, &txs); err != nil {
+		return nil, &fetchError{reason: failureReasonDecode, location: req.URL.String(), err: err}
+	}
+
+	return txs, nil
+}
+
+func cleanUp(resp *http.Response) {
+	_, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		logger.Warnf("[%v]", err)
+	}
+
+	err = resp.Body.Close()
+	if err != nil {
+		logger.Warnf("[%v]", err)
+	}
+}
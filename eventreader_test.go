@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Financial-Times/annotations-publish-healthchecker/fakereader"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventReaderSource_Errors(t *testing.T) {
+
+	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unparsable/transactions" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("some unparsable message"))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer healthcheckerServer.Close()
+
+	var tests = []struct {
+		scenario    string
+		address     string
+		contentType string
+		reason      string
+		statusCode  int
+		err         string
+	}{
+		{"Incorrect address - wrong protocol", "address", "annotations", failureReasonTransport, 0, "unsupported protocol scheme"},
+		{"Incorrect address - no response", "http://localhost:8080", "annotations", failureReasonTransport, 0, "connection refused"},
+		{"Server errors: 503", healthcheckerServer.URL, "annotations", failureReasonStatus, http.StatusServiceUnavailable, "unexpected status code 503"},
+		{"Unparsable body", healthcheckerServer.URL, "unparsable", failureReasonDecode, 0, "invalid character"},
+	}
+
+	for _, test := range tests {
+		source := newEventReaderSource(test.address, http.DefaultClient)
+
+		txs, err := source.FetchOpenTransactions(context.Background(), test.contentType, annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+
+		assert.Nil(t, txs, test.scenario)
+		if assert.IsType(t, &fetchError{}, err, test.scenario) {
+			fe := err.(*fetchError)
+			assert.Equal(t, test.reason, fe.reason, test.scenario)
+			assert.Equal(t, test.statusCode, fe.statusCode, test.scenario)
+			assert.Contains(t, fe.Error(), "failed to retrieve transactions from", test.scenario)
+			assert.Contains(t, fe.Error(), test.err, test.scenario)
+		}
+	}
+}
+
+func TestEventReaderSource_Timeout(t *testing.T) {
+
+	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+	}))
+	defer healthcheckerServer.Close()
+
+	source := newEventReaderSource(healthcheckerServer.URL, &http.Client{Timeout: 50 * time.Millisecond})
+	_, err := source.FetchOpenTransactions(context.Background(), "anyType", anyTypeConfig.EarliestTime, anyTypeConfig.LatestTime)
+
+	assert.Equal(t, failureReasonTransport, failureReasonOf(err))
+	assert.Contains(t, err.Error(), "Client.Timeout exceeded")
+}
+
+func TestEventReaderSource_Cancelled(t *testing.T) {
+
+	release := make(chan struct{})
+	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+	}))
+	defer healthcheckerServer.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	source := newEventReaderSource(healthcheckerServer.URL, http.DefaultClient)
+	_, err := source.FetchOpenTransactions(ctx, "anyType", anyTypeConfig.EarliestTime, anyTypeConfig.LatestTime)
+
+	assert.Equal(t, failureReasonTransport, failureReasonOf(err))
+}
+
+func TestEventReaderSource_200(t *testing.T) {
+
+	txs := transactions{
+		{
+			TransactionID: "tid1",
+			UUID:          "uuid1",
+			LastModified:  "2018-01-15T14:57:42.567Z",
+		},
+	}
+
+	msg, err := json.Marshal(txs)
+	assert.Nil(t, err)
+
+	var requestedURL string
+	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedURL = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+		w.Write(msg)
+	}))
+	defer healthcheckerServer.Close()
+
+	source := newEventReaderSource(healthcheckerServer.URL, http.DefaultClient)
+	res, err := source.FetchOpenTransactions(context.Background(), "anyType", anyTypeConfig.EarliestTime, anyTypeConfig.LatestTime)
+
+	assert.Nil(t, err)
+	assert.Equal(t, txs, res)
+	assert.Equal(t, "/anyType/transactions?earliestTime=-1h%40h&latestTime=-300s", requestedURL)
+}
+
+func TestDetermineHealth_FakeReaderScenario(t *testing.T) {
+
+	scenario, err := fakereader.Parse([]byte(`
+contentTypes:
+  annotations:
+    steps:
+      - repeat: 2
+        status: 503
+      - transactions:
+          - transaction_id: tid_old
+            uuid: uuid_old
+            age: 30m
+          - transaction_id: tid_recent
+            uuid: uuid_recent
+            age: 1m
+      - body: "[{"
+`))
+	assert.NoError(t, err)
+
+	server := fakereader.NewServer(scenario)
+	defer server.Close()
+
+	source := newEventReaderSource(server.URL+"/__splunk-event-reader", http.DefaultClient)
+	policy := retryPolicy{retries: 2, backoff: time.Millisecond}
+
+	// the failure burst is absorbed by the retries, and only the transaction older than the checking window is reported
+	res := determineHealth(context.Background(), source, policy, annotationsConfig, time.Now())
+	assert.True(t, res.Successful)
+	assert.Equal(t, 3, res.Attempts)
+	if assert.Len(t, res.OpenTransactions, 1) {
+		assert.Equal(t, "tid_old", res.OpenTransactions[0].TransactionID)
+	}
+
+	res = determineHealth(context.Background(), source, policy, annotationsConfig, time.Now())
+	assert.False(t, res.Successful)
+	assert.Equal(t, failureReasonDecode, res.failureReason)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	publishStartEvent = "PublishStart"
+	publishEndEvent   = "PublishEnd"
+)
+
+// publishEvent is a raw publish monitoring event, as logged by the publishing services and sent to Splunk.
+type publishEvent struct {
+	Time          string `json:"@time"`
+	Event         string `json:"event"`
+	TransactionID string `json:"transaction_id"`
+	UUID          string `json:"uuid"`
+	ContentType   string `json:"content_type"`
+}
+
+type openPublish struct {
+	uuid        string
+	contentType string
+	startedAt   time.Time
+}
+
+// eventCorrelator groups the raw publish events into transactions in memory, the way the splunk-event-reader does it with Splunk:
+// a transaction is open from its PublishStart until its PublishEnd. Both the open and the closed transactions are forgotten
+// once they are older than the retention, which should cover the longest checking window.
+type eventCorrelator struct {
+	retention time.Duration
+	open      map[string]openPublish
+	closed    map[string]time.Time
+	now       func() time.Time
+	sync.Mutex
+}
+
+func newEventCorrelator(retention time.Duration) *eventCorrelator {
+	return &eventCorrelator{retention: retention, open: map[string]openPublish{}, closed: map[string]time.Time{}, now: time.Now}
+}
+
+func (c *eventCorrelator) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+
+	now := c.now()
+	from := earliestTime.resolve(now)
+	to := latestTime.resolve(now)
+
+	c.Lock()
+	c.expire(now)
+	txs := transactions{}
+	for tid, publish := range c.open {
+		if strings.EqualFold(publish.contentType, contentType) && !publish.startedAt.Before(from) && !publish.startedAt.After(to) {
+			txs = append(txs, transaction{TransactionID: tid, UUID: publish.uuid, LastModified: publish.startedAt.Format(timestampFormat)})
+		}
+	}
+	c.Unlock()
+
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].LastModified < txs[j].LastModified || (txs[i].LastModified == txs[j].LastModified && txs[i].TransactionID < txs[j].TransactionID)
+	})
+	return txs, nil
+}
+
+// add correlates the given events. An end arriving before its start closes the transaction all the same.
+func (c *eventCorrelator) add(events []publishEvent) {
+
+	now := c.now()
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, event := range events {
+		at := now
+		if event.Time != "" {
+			// the events were validated when parsed
+			at, _ = time.Parse(time.RFC3339Nano, event.Time)
+		}
+
+		switch event.Event {
+		case publishStartEvent:
+			if _, found := c.closed[event.TransactionID]; found {
+				continue
+			}
+			if publish, found := c.open[event.TransactionID]; found && !at.Before(publish.startedAt) {
+				continue
+			}
+			c.open[event.TransactionID] = openPublish{uuid: event.UUID, contentType: event.ContentType, startedAt: at}
+		case publishEndEvent:
+			delete(c.open, event.TransactionID)
+			c.closed[event.TransactionID] = at
+		}
+	}
+	c.expire(now)
+}
+
+func (c *eventCorrelator) expire(now time.Time) {
+
+	if c.retention <= 0 {
+		return
+	}
+	oldest := now.Add(-c.retention)
+	for tid, publish := range c.open {
+		if publish.startedAt.Before(oldest) {
+			delete(c.open, tid)
+		}
+	}
+	for tid, closedAt := range c.closed {
+		if closedAt.Before(oldest) {
+			delete(c.closed, tid)
+		}
+	}
+}
+
+// readEvents correlates the events of a file at once, or follows the given standard input in the background when the path is "-".
+func (c *eventCorrelator) readEvents(path string, stdin io.Reader) error {
+
+	if path == "-" {
+		go func() {
+			if err := c.follow(stdin, "the standard input"); err != nil {
+				logger.WithError(err).Error("Stopped reading the events from the standard input")
+			}
+		}()
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.follow(file, path)
+}
+
+// ingestEvents parses the NDJSON events of the reader, and correlates them only if they are all valid.
+func (c *eventCorrelator) ingestEvents(r io.Reader) (int, error) {
+
+	events, err := parsePublishEvents(r)
+	if err != nil {
+		return 0, err
+	}
+	c.add(events)
+	return len(events), nil
+}
+
+// follow correlates the NDJSON events of the reader as they come, until it ends. Invalid lines are logged and skipped.
+func (c *eventCorrelator) follow(r io.Reader, name string) error {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		event, skip, err := parsePublishEvent(scanner.Bytes())
+		if err != nil {
+			logger.WithError(err).Warnf("Skipping line %d of %s", line, name)
+			continue
+		}
+		if !skip {
+			c.add([]publishEvent{event})
+		}
+	}
+	return scanner.Err()
+}
+
+func parsePublishEvents(r io.Reader) ([]publishEvent, error) {
+
+	var events []publishEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		event, skip, err := parsePublishEvent(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("invalid event on line %d: %v", line, err)
+		}
+		if !skip {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// parsePublishEvent parses a line of NDJSON. Empty lines and the events other than PublishStart and PublishEnd are skipped.
+func parsePublishEvent(line []byte) (publishEvent, bool, error) {
+
+	var event publishEvent
+	if len(strings.TrimSpace(string(line))) == 0 {
+		return event, true, nil
+	}
+	if err := json.Unmarshal(line, &event); err != nil {
+		return event, false, err
+	}
+	if event.Event != publishStartEvent && event.Event != publishEndEvent {
+		return event, true, nil
+	}
+	if event.TransactionID == "" {
+		return event, false, fmt.Errorf("%s event has no transaction_id", event.Event)
+	}
+	if event.Event == publishStartEvent && event.ContentType == "" {
+		return event, false, fmt.Errorf("%s event of %s has no content_type", event.Event, event.TransactionID)
+	}
+	if event.Time != "" {
+		if _, err := time.Parse(time.RFC3339Nano, event.Time); err != nil {
+			return event, false, fmt.Errorf("@time of %s should be an RFC3339 timestamp, got %q", event.TransactionID, event.Time)
+		}
+	}
+	return event, false, nil
+}
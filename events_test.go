@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	logger "github.com/Financial-Times/go-logger/test"
+)
+
+var eventsNow = time.Date(2018, 1, 15, 14, 30, 0, 0, time.UTC)
+
+func newTestCorrelator() *eventCorrelator {
+	c := newEventCorrelator(24 * time.Hour)
+	c.now = func() time.Time { return eventsNow }
+	return c
+}
+
+func start(at time.Time, tid string, contentType string) publishEvent {
+	return publishEvent{Time: at.Format(time.RFC3339Nano), Event: publishStartEvent, TransactionID: tid, UUID: "uuid_" + tid, ContentType: contentType}
+}
+
+func end(at time.Time, tid string) publishEvent {
+	return publishEvent{Time: at.Format(time.RFC3339Nano), Event: publishEndEvent, TransactionID: tid}
+}
+
+func openTransactionIDs(t *testing.T, c *eventCorrelator, contentType string) []string {
+
+	txs, err := c.FetchOpenTransactions(context.Background(), contentType, annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+	assert.NoError(t, err)
+
+	tids := []string{}
+	for _, tx := range txs {
+		tids = append(tids, tx.TransactionID)
+	}
+	return tids
+}
+
+func TestEventCorrelator_CorrelatesTransactions(t *testing.T) {
+
+	c := newTestCorrelator()
+	c.add([]publishEvent{
+		start(eventsNow.Add(-10*time.Minute), "tid_open", "Annotations"),
+		start(eventsNow.Add(-12*time.Minute), "tid_closed", "annotations"),
+		end(eventsNow.Add(-11*time.Minute), "tid_closed"),
+		start(eventsNow.Add(-13*time.Minute), "tid_other_type", "lists"),
+		start(eventsNow.Add(-30*time.Minute), "tid_too_old", "annotations"),
+		start(eventsNow.Add(-2*time.Minute), "tid_too_recent", "annotations"),
+	})
+
+	txs, err := c.FetchOpenTransactions(context.Background(), "annotations", annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, transactions{{TransactionID: "tid_open", UUID: "uuid_tid_open", LastModified: "2018-01-15T14:20:00Z"}}, txs)
+	assert.Equal(t, []string{"tid_other_type"}, openTransactionIDs(t, c, "lists"))
+}
+
+func TestEventCorrelator_EndBeforeStart(t *testing.T) {
+
+	c := newTestCorrelator()
+	c.add([]publishEvent{end(eventsNow.Add(-9*time.Minute), "tid_1")})
+	c.add([]publishEvent{start(eventsNow.Add(-10*time.Minute), "tid_1", "annotations")})
+
+	assert.Empty(t, openTransactionIDs(t, c, "annotations"))
+}
+
+func TestEventCorrelator_KeepsTheFirstStart(t *testing.T) {
+
+	c := newTestCorrelator()
+	c.add([]publishEvent{
+		start(eventsNow.Add(-10*time.Minute), "tid_1", "annotations"),
+		start(eventsNow.Add(-8*time.Minute), "tid_1", "annotations"),
+	})
+
+	txs, err := c.FetchOpenTransactions(context.Background(), "annotations", annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+
+	assert.NoError(t, err)
+	if assert.Len(t, txs, 1) {
+		assert.Equal(t, "2018-01-15T14:20:00Z", txs[0].LastModified)
+	}
+}
+
+func TestEventCorrelator_Expires(t *testing.T) {
+
+	c := newTestCorrelator()
+	c.retention = 20 * time.Minute
+	c.add([]publishEvent{
+		start(eventsNow.Add(-25*time.Minute), "tid_expired", "annotations"),
+		end(eventsNow.Add(-25*time.Minute), "tid_closed"),
+		start(eventsNow.Add(-10*time.Minute), "tid_open", "annotations"),
+	})
+
+	assert.Len(t, c.open, 1)
+	assert.Empty(t, c.closed)
+	assert.Equal(t, []string{"tid_open"}, openTransactionIDs(t, c, "annotations"))
+}
+
+func TestEventCorrelator_UsesTheArrivalTimeWithoutEventTime(t *testing.T) {
+
+	c := newTestCorrelator()
+	c.add([]publishEvent{{Event: publishStartEvent, TransactionID: "tid_1", ContentType: "annotations"}})
+
+	assert.Equal(t, eventsNow, c.open["tid_1"].startedAt)
+}
+
+func TestParsePublishEvents(t *testing.T) {
+
+	events, err := parsePublishEvents(strings.NewReader(`{"@time":"2018-01-15T14:00:00.123Z","event":"PublishStart","transaction_id":"tid_1","uuid":"uuid_1","content_type":"annotations"}
+
+{"@time":"2018-01-15T14:00:01Z","event":"Mapped","transaction_id":"tid_1"}
+{"@time":"2018-01-15T14:00:02Z","event":"PublishEnd","transaction_id":"tid_1"}
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []publishEvent{
+		{Time: "2018-01-15T14:00:00.123Z", Event: publishStartEvent, TransactionID: "tid_1", UUID: "uuid_1", ContentType: "annotations"},
+		{Time: "2018-01-15T14:00:02Z", Event: publishEndEvent, TransactionID: "tid_1"},
+	}, events)
+}
+
+func TestParsePublishEvents_Invalid(t *testing.T) {
+
+	var tests = []struct {
+		scenario string
+		line     string
+		err      string
+	}{
+		{"Not JSON", `PublishStart tid_1`, "invalid event on line 2: invalid character"},
+		{"No transaction ID", `{"event":"PublishEnd"}`, "invalid event on line 2: PublishEnd event has no transaction_id"},
+		{"No content type", `{"event":"PublishStart","transaction_id":"tid_1"}`, "invalid event on line 2: PublishStart event of tid_1 has no content_type"},
+		{"Invalid time", `{"@time":"yesterday","event":"PublishEnd","transaction_id":"tid_1"}`, `invalid event on line 2: @time of tid_1 should be an RFC3339 timestamp, got "yesterday"`},
+	}
+
+	for _, test := range tests {
+		c := newTestCorrelator()
+		accepted, err := c.ingestEvents(strings.NewReader(`{"event":"PublishStart","transaction_id":"tid_0","content_type":"annotations"}` + "\n" + test.line))
+
+		assert.Equal(t, 0, accepted, test.scenario)
+		if assert.Error(t, err, test.scenario) {
+			assert.Contains(t, err.Error(), test.err, test.scenario)
+		}
+		// nothing is correlated from an invalid batch
+		assert.Empty(t, c.open, test.scenario)
+	}
+}
+
+func TestEventCorrelator_ReadEvents(t *testing.T) {
+
+	hook := logger.NewTestHook("healthchecker-test")
+
+	dir, err := ioutil.TempDir("", "events")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.ndjson")
+	ioutil.WriteFile(path, []byte(`{"@time":"2018-01-15T14:20:00Z","event":"PublishStart","transaction_id":"tid_1","uuid":"uuid_1","content_type":"annotations"}
+not an event
+{"@time":"2018-01-15T14:19:00Z","event":"PublishStart","transaction_id":"tid_2","uuid":"uuid_2","content_type":"annotations"}
+{"@time":"2018-01-15T14:21:00Z","event":"PublishEnd","transaction_id":"tid_2"}
+`), 0644)
+
+	c := newTestCorrelator()
+	assert.NoError(t, c.readEvents(path, nil))
+
+	// invalid lines of a file are skipped
+	assert.Equal(t, []string{"tid_1"}, openTransactionIDs(t, c, "annotations"))
+	assert.Equal(t, "Skipping line 2 of "+path, hook.LastEntry().Message)
+
+	assert.Error(t, c.readEvents(filepath.Join(dir, "missing.ndjson"), nil))
+}
+
+func TestEventCorrelator_FollowsTheStandardInput(t *testing.T) {
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+
+	c := newTestCorrelator()
+	assert.NoError(t, c.readEvents("-", r))
+
+	w.Write([]byte(`{"@time":"2018-01-15T14:20:00Z","event":"PublishStart","transaction_id":"tid_1","uuid":"uuid_1","content_type":"annotations"}` + "\n"))
+	w.Close()
+
+	for i := 0; i < 100 && len(openTransactionIDs(t, c, "annotations")) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []string{"tid_1"}, openTransactionIDs(t, c, "annotations"))
+}
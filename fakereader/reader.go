@@ -0,0 +1,133 @@
+// Package fakereader stands in for the Splunk Event Reader, serving scripted responses on /{contentType}/transactions.
+// It backs the fake-reader subcommand, and can be imported by tests to exercise failure bursts, latency,
+// 5xx responses, malformed bodies and timeouts without Splunk.
+package fakereader
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const transactionsPath = "/transactions"
+
+// Reader is an http.Handler playing a scenario. The requests of every content type advance its own script.
+type Reader struct {
+	scenario Scenario
+	requests map[string]int
+	now      func() time.Time
+	sync.Mutex
+}
+
+type openTransaction struct {
+	TransactionID string `json:"transaction_id"`
+	UUID          string `json:"uuid"`
+	StartTime     string `json:"start_time"`
+}
+
+// New creates a reader playing the given scenario.
+func New(scenario Scenario) *Reader {
+	return &Reader{scenario: scenario, requests: map[string]int{}, now: time.Now}
+}
+
+// NewServer starts a server playing the given scenario. Its URL can be used as the event reader address.
+func NewServer(scenario Scenario) *httptest.Server {
+	return httptest.NewServer(New(scenario))
+}
+
+// Requests tells how many requests were received for the given content type.
+func (reader *Reader) Requests(contentType string) int {
+
+	reader.Lock()
+	defer reader.Unlock()
+
+	return reader.requests[contentType]
+}
+
+func (reader *Reader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	// the address of the event reader may have a path prefix, e.g. /__splunk-event-reader
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if r.Method != http.MethodGet || !strings.HasSuffix(path, transactionsPath) {
+		http.NotFound(w, r)
+		return
+	}
+	path = strings.TrimSuffix(path, transactionsPath)
+	contentType := path[strings.LastIndex(path, "/")+1:]
+	if contentType == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	step := reader.next(contentType)
+
+	if step.Hang {
+		<-r.Context().Done()
+		return
+	}
+	if step.Latency > 0 {
+		select {
+		case <-time.After(time.Duration(step.Latency)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if step.Body != nil {
+		w.WriteHeader(step.status())
+		w.Write([]byte(*step.Body))
+		return
+	}
+
+	txs := []openTransaction{}
+	for _, tx := range step.Transactions {
+		txs = append(txs, reader.open(tx))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(step.status())
+	json.NewEncoder(w).Encode(txs)
+}
+
+// next returns the step answering the current request of the content type, and moves its script forward.
+func (reader *Reader) next(contentType string) Step {
+
+	reader.Lock()
+	n := reader.requests[contentType]
+	reader.requests[contentType] = n + 1
+	reader.Unlock()
+
+	script := reader.scenario.ContentTypes[contentType]
+	if len(script.Steps) == 0 {
+		return Step{}
+	}
+
+	total := 0
+	for _, step := range script.Steps {
+		total += step.repeat()
+	}
+	if n >= total {
+		if !script.Loop {
+			return script.Steps[len(script.Steps)-1]
+		}
+		n = n % total
+	}
+	for _, step := range script.Steps {
+		if n < step.repeat() {
+			return step
+		}
+		n -= step.repeat()
+	}
+	return script.Steps[len(script.Steps)-1]
+}
+
+func (reader *Reader) open(tx Transaction) openTransaction {
+
+	startTime := tx.StartTime
+	if startTime == "" {
+		startTime = reader.now().Add(-time.Duration(tx.Age)).UTC().Format(time.RFC3339Nano)
+	}
+	return openTransaction{TransactionID: tx.TransactionID, UUID: tx.UUID, StartTime: startTime}
+}
@@ -0,0 +1,123 @@
+package fakereader
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, url string) (int, string) {
+
+	resp, err := http.Get(url)
+	if !assert.NoError(t, err) {
+		return 0, ""
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestReaderPlaysTheScriptInOrder(t *testing.T) {
+
+	malformed := "{not json"
+	server := NewServer(Scenario{ContentTypes: map[string]Script{
+		"annotations": {Steps: []Step{
+			{Repeat: 2, Status: http.StatusServiceUnavailable},
+			{Body: &malformed},
+			{Transactions: []Transaction{{TransactionID: "tid_1", UUID: "uuid_1", StartTime: "2017-10-16T14:00:00.000Z"}}},
+		}},
+	}})
+	defer server.Close()
+
+	url := server.URL + "/__splunk-event-reader/annotations/transactions?earliestTime=-15m&latestTime=-5m"
+
+	status, _ := get(t, url)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	status, _ = get(t, url)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	status, body := get(t, url)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, malformed, body)
+
+	// the last step keeps answering once the script is over
+	for i := 0; i < 2; i++ {
+		status, body = get(t, url)
+		assert.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `[{"transaction_id": "tid_1", "uuid": "uuid_1", "start_time": "2017-10-16T14:00:00.000Z"}]`, body)
+	}
+}
+
+func TestReaderLoopsTheScript(t *testing.T) {
+
+	reader := New(Scenario{ContentTypes: map[string]Script{
+		"annotations": {Loop: true, Steps: []Step{{Status: http.StatusInternalServerError}, {}}},
+	}})
+
+	var steps []Step
+	for i := 0; i < 4; i++ {
+		steps = append(steps, reader.next("annotations"))
+	}
+
+	assert.Equal(t, []Step{{Status: http.StatusInternalServerError}, {}, {Status: http.StatusInternalServerError}, {}}, steps)
+	assert.Equal(t, 4, reader.Requests("annotations"))
+	assert.Equal(t, 0, reader.Requests("lists"))
+}
+
+func TestReaderServesUnscriptedContentTypesNoTransactions(t *testing.T) {
+
+	server := NewServer(Scenario{})
+	defer server.Close()
+
+	status, body := get(t, server.URL+"/lists/transactions")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `[]`, body)
+}
+
+func TestReaderServesNotFoundForOtherPaths(t *testing.T) {
+
+	server := NewServer(Scenario{})
+	defer server.Close()
+
+	status, _ := get(t, server.URL+"/__health")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = get(t, server.URL+"/transactions")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestReaderComputesStartTimesFromAges(t *testing.T) {
+
+	reader := New(Scenario{})
+	reader.now = func() time.Time { return time.Date(2017, 10, 16, 14, 20, 0, 0, time.UTC) }
+
+	tx := reader.open(Transaction{TransactionID: "tid_1", Age: Duration(20 * time.Minute)})
+
+	assert.Equal(t, "2017-10-16T14:00:00Z", tx.StartTime)
+	msg, _ := json.Marshal(tx)
+	assert.JSONEq(t, `{"transaction_id": "tid_1", "uuid": "", "start_time": "2017-10-16T14:00:00Z"}`, string(msg))
+}
+
+func TestReaderDelaysAndHangs(t *testing.T) {
+
+	server := NewServer(Scenario{ContentTypes: map[string]Script{
+		"annotations": {Steps: []Step{{Latency: Duration(50 * time.Millisecond)}}},
+		"lists":       {Steps: []Step{{Hang: true}}},
+	}})
+	defer server.Close()
+
+	start := time.Now()
+	status, _ := get(t, server.URL+"/annotations/transactions")
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	_, err := client.Get(server.URL + "/lists/transactions")
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package fakereader
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Scenario scripts the responses served for every content type.
+// Content types missing from the scenario are served an empty list of transactions.
+type Scenario struct {
+	ContentTypes map[string]Script `yaml:"contentTypes"`
+}
+
+// Script is the sequence of steps answering the requests of one content type.
+// Once every step was played, the script starts over if it loops, otherwise its last step keeps answering.
+type Script struct {
+	Loop  bool   `yaml:"loop"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Step describes how the next requests are answered.
+type Step struct {
+	// number of consecutive requests answered by the step, 1 if not set
+	Repeat int `yaml:"repeat"`
+	// delay before answering
+	Latency Duration `yaml:"latency"`
+	// HTTP status of the response, 200 if not set
+	Status int `yaml:"status"`
+	// open transactions returned in the response
+	Transactions []Transaction `yaml:"transactions"`
+	// raw body sent instead of the transactions, e.g. malformed JSON
+	Body *string `yaml:"body"`
+	// never answer, so that the caller times out
+	Hang bool `yaml:"hang"`
+}
+
+// Transaction is an open transaction as returned by the Splunk Event Reader.
+// Its start time is either given as a timestamp, or as an age relative to the time it is served.
+type Transaction struct {
+	TransactionID string   `yaml:"transaction_id"`
+	UUID          string   `yaml:"uuid"`
+	StartTime     string   `yaml:"start_time"`
+	Age           Duration `yaml:"age"`
+}
+
+// Duration is a time.Duration read from strings like "500ms" or "2m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected something like 500ms or 2m", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Parse reads a scenario in YAML or JSON.
+func Parse(data []byte) (Scenario, error) {
+
+	var scenario Scenario
+	if err := yaml.UnmarshalStrict(data, &scenario); err != nil {
+		return Scenario{}, fmt.Errorf("scenario is not valid YAML or JSON: %v", err)
+	}
+
+	for contentType, script := range scenario.ContentTypes {
+		for i, step := range script.Steps {
+			if err := step.validate(); err != nil {
+				return Scenario{}, fmt.Errorf("step %d of %s: %v", i+1, contentType, err)
+			}
+		}
+	}
+	return scenario, nil
+}
+
+// Load reads a scenario from a YAML or JSON file.
+func Load(path string) (Scenario, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Scenario{}, err
+	}
+	return Parse(data)
+}
+
+func (step Step) validate() error {
+
+	switch {
+	case step.Repeat < 0:
+		return fmt.Errorf("repeat should not be negative")
+	case step.Latency < 0:
+		return fmt.Errorf("latency should not be negative")
+	case step.Status != 0 && http.StatusText(step.Status) == "":
+		return fmt.Errorf("unknown status %d", step.Status)
+	case step.Body != nil && len(step.Transactions) > 0:
+		return fmt.Errorf("either a body or transactions should be given, not both")
+	}
+	return nil
+}
+
+func (step Step) repeat() int {
+	if step.Repeat == 0 {
+		return 1
+	}
+	return step.Repeat
+}
+
+func (step Step) status() int {
+	if step.Status == 0 {
+		return http.StatusOK
+	}
+	return step.Status
+}
@@ -0,0 +1,89 @@
+package fakereader
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const yamlScenario = `
+contentTypes:
+  annotations:
+    loop: true
+    steps:
+      - repeat: 3
+        status: 503
+      - latency: 1500ms
+        transactions:
+          - transaction_id: tid_1
+            uuid: uuid_1
+            age: 20m
+      - body: "{not json"
+  lists:
+    steps:
+      - hang: true
+`
+
+func TestParseYAML(t *testing.T) {
+
+	scenario, err := Parse([]byte(yamlScenario))
+
+	assert.NoError(t, err)
+	annotations := scenario.ContentTypes["annotations"]
+	assert.True(t, annotations.Loop)
+	assert.Len(t, annotations.Steps, 3)
+	assert.Equal(t, 3, annotations.Steps[0].Repeat)
+	assert.Equal(t, 503, annotations.Steps[0].Status)
+	assert.Equal(t, Duration(1500*time.Millisecond), annotations.Steps[1].Latency)
+	assert.Equal(t, []Transaction{{TransactionID: "tid_1", UUID: "uuid_1", Age: Duration(20 * time.Minute)}}, annotations.Steps[1].Transactions)
+	assert.Equal(t, "{not json", *annotations.Steps[2].Body)
+	assert.True(t, scenario.ContentTypes["lists"].Steps[0].Hang)
+}
+
+func TestParseJSON(t *testing.T) {
+
+	scenario, err := Parse([]byte(`{"contentTypes": {"annotations": {"steps": [{"status": 500, "repeat": 2}, {"transactions": [{"transaction_id": "tid_1", "start_time": "2017-10-16T14:00:00.000Z"}]}]}}}`))
+
+	assert.NoError(t, err)
+	steps := scenario.ContentTypes["annotations"].Steps
+	assert.Len(t, steps, 2)
+	assert.Equal(t, 500, steps[0].Status)
+	assert.Equal(t, "2017-10-16T14:00:00.000Z", steps[1].Transactions[0].StartTime)
+}
+
+func TestParseInvalid(t *testing.T) {
+
+	tests := map[string]string{
+		"not yaml":          `contentTypes: [`,
+		"unknown field":     `{"contentTypes": {"annotations": {"steps": [{"statuz": 500}]}}}`,
+		"invalid duration":  `{"contentTypes": {"annotations": {"steps": [{"latency": "soon"}]}}}`,
+		"negative repeat":   `{"contentTypes": {"annotations": {"steps": [{"repeat": -1}]}}}`,
+		"unknown status":    `{"contentTypes": {"annotations": {"steps": [{"status": 999}]}}}`,
+		"body and payloads": `{"contentTypes": {"annotations": {"steps": [{"body": "", "transactions": [{"transaction_id": "tid_1"}]}]}}}`,
+	}
+
+	for name, scenario := range tests {
+		_, err := Parse([]byte(scenario))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "fakereader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "scenario.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(yamlScenario), 0644))
+
+	scenario, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, scenario.ContentTypes, 2)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -1,13 +1,39 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/Financial-Times/go-logger"
+	"github.com/gorilla/mux"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// maxEventsBodySize limits the size of a batch of events pushed to POST /__events
+const maxEventsBodySize = 10 * 1024 * 1024
+
+type onDemandChecker interface {
+	checkNow() (interface{}, error)
+}
+
+type transactionQuerier interface {
+	query(ctx context.Context, q transactionQuery) (interface{}, error)
+}
+
+type eventIngester interface {
+	ingestEvents(r io.Reader) (int, error)
+}
+
 type requestHandler struct {
 	healthchecker healthchecker
+	checker       onDemandChecker
+	querier       transactionQuerier
+	events        eventIngester
+	history       *healthHistory
+	silences      *silenceStore
 }
 
 func (handler *requestHandler) getHealthDetails(writer http.ResponseWriter, request *http.Request) {
@@ -24,3 +50,238 @@ func (handler *requestHandler) getHealthDetails(writer http.ResponseWriter, requ
 		writer.Write(msg)
 	}
 }
+
+func (handler *requestHandler) runCheck(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	statuses, err := handler.checker.checkNow()
+	if err != nil {
+		if rle, ok := err.(*rateLimitError); ok {
+			writer.Header().Set("Retry-After", strconv.Itoa(rle.retryAfterSeconds()))
+			writeMessage(writer, http.StatusTooManyRequests, err.Error())
+		} else {
+			writeMessage(writer, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	msg, err := json.Marshal(statuses)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(msg)
+	}
+}
+
+func (handler *requestHandler) queryTransactions(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	params := request.URL.Query()
+	q := transactionQuery{ContentType: params.Get("contentType")}
+	if q.ContentType == "" {
+		writeMessage(writer, http.StatusBadRequest, "contentType is required")
+		return
+	}
+
+	if err := parseRelativeTimeParam(request, earliestTimePathVar, &q.EarliestTime); err != nil {
+		writeMessage(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := parseRelativeTimeParam(request, latestTimePathVar, &q.LatestTime); err != nil {
+		writeMessage(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if value := params.Get("slaWindow"); value != "" {
+		slaWindow, err := strconv.Atoi(value)
+		if err != nil || slaWindow < 0 {
+			writeMessage(writer, http.StatusBadRequest, fmt.Sprintf("slaWindow should be a number of minutes, got %q", value))
+			return
+		}
+		q.SLAWindow = &slaWindow
+	}
+
+	result, err := handler.querier.query(request.Context(), q)
+	if err != nil {
+		if _, ok := err.(*invalidQueryError); ok {
+			writeMessage(writer, http.StatusBadRequest, err.Error())
+		} else {
+			writeMessage(writer, http.StatusBadGateway, err.Error())
+		}
+		return
+	}
+
+	msg, err := json.Marshal(result)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(msg)
+	}
+}
+
+func (handler *requestHandler) ingestEvents(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	accepted, err := handler.events.ingestEvents(http.MaxBytesReader(writer, request.Body, maxEventsBodySize))
+	if err != nil {
+		writeMessage(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msg, err := json.Marshal(map[string]int{"accepted": accepted})
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(msg)
+	}
+}
+
+func (handler *requestHandler) createSilence(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	s, err := handler.silences.create(http.MaxBytesReader(writer, request.Body, maxSilenceBodySize))
+	if err != nil {
+		writeMessage(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	logger.Infof("Silence %s created by %s: %s", s.ID, s.Author, s.Comment)
+
+	msg, err := json.Marshal(s)
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+	} else {
+		writer.WriteHeader(http.StatusCreated)
+		writer.Write(msg)
+	}
+}
+
+func (handler *requestHandler) listSilences(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	msg, err := json.Marshal(handler.silences.list())
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(msg)
+	}
+}
+
+func (handler *requestHandler) deleteSilence(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	id := mux.Vars(request)["id"]
+	if !handler.silences.remove(id) {
+		writeMessage(writer, http.StatusNotFound, fmt.Sprintf("no active silence %s", id))
+		return
+	}
+	logger.Infof("Silence %s deleted", id)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *requestHandler) getHistory(writer http.ResponseWriter, request *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	from, err := parseTimeParam(request, "from")
+	if err != nil {
+		writeMessage(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseTimeParam(request, "to")
+	if err != nil {
+		writeMessage(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			writeMessage(writer, http.StatusBadRequest, fmt.Sprintf("limit should be a positive number, got %q", value))
+			return
+		}
+	}
+
+	summary := false
+	if value := request.URL.Query().Get("summary"); value != "" {
+		summary, err = strconv.ParseBool(value)
+		if err != nil {
+			writeMessage(writer, http.StatusBadRequest, fmt.Sprintf("summary should be true or false, got %q", value))
+			return
+		}
+	}
+
+	entries := handler.history.query(from, to, limit)
+
+	var msg []byte
+	if summary {
+		msg, err = json.Marshal(summarise(entries))
+	} else {
+		msg, err = json.Marshal(entries)
+	}
+
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+	} else {
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(msg)
+	}
+}
+
+func parseTimeParam(request *http.Request, name string) (time.Time, error) {
+
+	value := request.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s should be an RFC3339 timestamp, got %q", name, value)
+	}
+	return t, nil
+}
+
+func parseRelativeTimeParam(request *http.Request, name string, rt *relativeTime) error {
+
+	value := request.URL.Query().Get(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := parseQueryTime(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	*rt = parsed
+	return nil
+}
+
+func writeMessage(writer http.ResponseWriter, status int, message string) {
+
+	msg, err := json.Marshal(map[string]string{"message": message})
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		logger.Error(err)
+		return
+	}
+
+	writer.WriteHeader(status)
+	writer.Write(msg)
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/Financial-Times/go-logger"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetHealthDetails_200(t *testing.T) {
@@ -23,7 +29,7 @@ func TestGetHealthDetails_200(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	h := requestHandler{&mockService{healthStatus: status}}
+	h := requestHandler{healthchecker: &mockService{healthStatus: status}}
 	handler := http.HandlerFunc(h.getHealthDetails)
 	handler.ServeHTTP(rr, req)
 
@@ -37,6 +43,8 @@ func TestGetHealthDetails_200(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v",
 			rr.Body.String(), string(msg))
 	}
+	assert.Contains(t, rr.Body.String(), `"event_reader_checking_age_seconds":0`, "fresh data still has an age")
+	assert.Contains(t, rr.Body.String(), `"stale":false`)
 }
 
 func TestGetHealthDetails_500(t *testing.T) {
@@ -49,7 +57,7 @@ func TestGetHealthDetails_500(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	h := requestHandler{&mockService{healthStatus: make(chan int)}}
+	h := requestHandler{healthchecker: &mockService{healthStatus: make(chan int)}}
 	handler := http.HandlerFunc(h.getHealthDetails)
 	handler.ServeHTTP(rr, req)
 
@@ -64,6 +72,156 @@ func TestGetHealthDetails_500(t *testing.T) {
 	}
 }
 
+func TestGetHistory(t *testing.T) {
+
+	history := newHealthHistory(10, 0)
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		history.add(now.Add(time.Duration(i)*time.Minute), map[string]healthStatus{"annotations": {OpenTransactions: testTxs[:i], Successful: true}})
+	}
+	h := requestHandler{history: history}
+
+	var tests = []struct {
+		scenario       string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"All", "", http.StatusOK, ""},
+		{"Invalid from", "?from=yesterday", http.StatusBadRequest, `{"message":"from should be an RFC3339 timestamp, got \"yesterday\""}`},
+		{"Invalid to", "?to=1", http.StatusBadRequest, `{"message":"to should be an RFC3339 timestamp, got \"1\""}`},
+		{"Invalid limit", "?limit=0", http.StatusBadRequest, `{"message":"limit should be a positive number, got \"0\""}`},
+		{"Invalid summary", "?summary=maybe", http.StatusBadRequest, `{"message":"summary should be true or false, got \"maybe\""}`},
+		{"Summary", fmt.Sprintf("?summary=true&from=%s&limit=1", now.Add(time.Minute).Format(time.RFC3339)), http.StatusOK,
+			fmt.Sprintf(`[{"time":%q,"failed_transactions":{"annotations":2}}]`, now.Add(2*time.Minute).Format(time.RFC3339))},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/__history"+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getHistory).ServeHTTP(rr, req)
+
+		assert.Equal(t, test.expectedStatus, rr.Code, test.scenario)
+		if test.expectedBody != "" {
+			assert.JSONEq(t, test.expectedBody, rr.Body.String(), test.scenario)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/__history", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getHistory).ServeHTTP(rr, req)
+
+	assert.NotContains(t, rr.Body.String(), "event_reader_checking_age_seconds", "past results have no age")
+	assert.NotContains(t, rr.Body.String(), "stale")
+
+	var entries []historyEntry
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+	assert.Len(t, entries, 3)
+	assert.Equal(t, testTxs[:1], entries[1].Statuses["annotations"].OpenTransactions)
+}
+
+func TestRunCheck(t *testing.T) {
+
+	statuses := map[string]healthStatus{"annotations": {OpenTransactions: testTxs, Successful: true}}
+	msg, err := json.Marshal(statuses)
+	assert.NoError(t, err)
+
+	var tests = []struct {
+		scenario           string
+		checker            *mockChecker
+		expectedStatus     int
+		expectedBody       string
+		expectedRetryAfter string
+	}{
+		{"Check run", &mockChecker{statuses: statuses}, http.StatusOK, string(msg), ""},
+		{"Rate limited", &mockChecker{err: &rateLimitError{retryAfter: 12 * time.Second}}, http.StatusTooManyRequests, `{"message":"too many on-demand checks, retry in 12 seconds"}`, "12"},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/__check", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := requestHandler{checker: test.checker}
+		http.HandlerFunc(h.runCheck).ServeHTTP(rr, req)
+
+		assert.Equal(t, test.expectedStatus, rr.Code, test.scenario)
+		assert.JSONEq(t, test.expectedBody, rr.Body.String(), test.scenario)
+		assert.Equal(t, test.expectedRetryAfter, rr.Header().Get("Retry-After"), test.scenario)
+	}
+}
+
+func TestQueryTransactions(t *testing.T) {
+
+	result := queryResult{ContentType: "annotations", FailedTransactions: testTxs}
+	msg, err := json.Marshal(result)
+	assert.NoError(t, err)
+
+	var tests = []struct {
+		scenario       string
+		query          string
+		querier        *mockQuerier
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Query", "?contentType=annotations&earliestTime=2018-01-15T09:00:00Z&latestTime=2018-01-15T09:30:00Z&slaWindow=0", &mockQuerier{result: result}, http.StatusOK, string(msg)},
+		{"No content type", "?earliestTime=-1h", &mockQuerier{}, http.StatusBadRequest, `{"message":"contentType is required"}`},
+		{"Invalid earliest time", "?contentType=annotations&earliestTime=yesterday", &mockQuerier{}, http.StatusBadRequest,
+			`{"message":"invalid earliestTime: \"yesterday\" is not a valid relative time, expected something like -15m, -1h@h or an RFC3339 timestamp"}`},
+		{"Invalid latest time", "?contentType=annotations&latestTime=-5w", &mockQuerier{}, http.StatusBadRequest,
+			`{"message":"invalid latestTime: \"-5w\" has an unsupported time unit \"w\", use s, m, h or d"}`},
+		{"Invalid SLA window", "?contentType=annotations&slaWindow=-1", &mockQuerier{}, http.StatusBadRequest, `{"message":"slaWindow should be a number of minutes, got \"-1\""}`},
+		{"Invalid query", "?contentType=content", &mockQuerier{err: &invalidQueryError{"unknown content type"}}, http.StatusBadRequest, `{"message":"unknown content type"}`},
+		{"Fetch error", "?contentType=annotations", &mockQuerier{err: status503Err}, http.StatusBadGateway, `{"message":"failed to retrieve transactions: unexpected status code 503"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/__query"+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := requestHandler{querier: test.querier}
+		http.HandlerFunc(h.queryTransactions).ServeHTTP(rr, req)
+
+		assert.Equal(t, test.expectedStatus, rr.Code, test.scenario)
+		assert.JSONEq(t, test.expectedBody, rr.Body.String(), test.scenario)
+	}
+
+	querier := tests[0].querier
+	assert.Equal(t, "annotations", querier.received.ContentType)
+	assert.Equal(t, time.Date(2018, 1, 15, 9, 0, 0, 0, time.UTC), querier.received.EarliestTime.resolve(time.Now()))
+	assert.Equal(t, time.Date(2018, 1, 15, 9, 30, 0, 0, time.UTC), querier.received.LatestTime.resolve(time.Now()))
+	assert.Equal(t, 0, *querier.received.SLAWindow)
+}
+
+type mockQuerier struct {
+	result   interface{}
+	err      error
+	received transactionQuery
+}
+
+func (mq *mockQuerier) query(ctx context.Context, q transactionQuery) (interface{}, error) {
+	mq.received = q
+	return mq.result, mq.err
+}
+
+type mockChecker struct {
+	statuses interface{}
+	err      error
+}
+
+func (mc *mockChecker) checkNow() (interface{}, error) {
+	return mc.statuses, mc.err
+}
+
 type mockService struct {
 	healthStatus interface{}
 }
@@ -71,3 +229,77 @@ type mockService struct {
 func (ms *mockService) getHealthStatus() interface{} {
 	return ms.healthStatus
 }
+
+func TestIngestEvents(t *testing.T) {
+
+	var tests = []struct {
+		scenario       string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"Valid events", `{"@time":"2018-01-15T14:00:00Z","event":"PublishStart","transaction_id":"tid_1","uuid":"uuid_1","content_type":"annotations"}` + "\n" + `{"event":"PublishEnd","transaction_id":"tid_1"}`, http.StatusOK, `{"accepted":2}`},
+		{"Invalid event", `{"event":"PublishStart","transaction_id":"tid_1"}`, http.StatusBadRequest, `{"message":"invalid event on line 1: PublishStart event of tid_1 has no content_type"}`},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "/__events", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		h := requestHandler{events: newEventCorrelator(time.Hour)}
+		http.HandlerFunc(h.ingestEvents).ServeHTTP(rr, req)
+
+		assert.Equal(t, test.expectedStatus, rr.Code, test.scenario)
+		assert.JSONEq(t, test.expectedBody, rr.Body.String(), test.scenario)
+	}
+}
+
+func TestSilences(t *testing.T) {
+
+	h := requestHandler{silences: newSilenceStore(time.Hour)}
+	router := mux.NewRouter()
+	router.HandleFunc("/__silences", h.createSilence).Methods("POST")
+	router.HandleFunc("/__silences", h.listSilences).Methods("GET")
+	router.HandleFunc("/__silences/{id}", h.deleteSilence).Methods("DELETE")
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/__silences", `{"uuid":"uuid1","author":"jane.doe","comment":"test content","duration":"30m"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created silence
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, "uuid1", created.UUID)
+	assert.Equal(t, "jane.doe", created.Author)
+
+	rr = serve("POST", "/__silences", `{"uuid":"uuid1","author":"jane.doe","duration":"30m"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"message":"a silence needs an author and a comment"}`, rr.Body.String())
+
+	rr = serve("GET", "/__silences", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var listed []silence
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Len(t, listed, 1)
+	assert.Equal(t, created.ID, listed[0].ID)
+
+	rr = serve("DELETE", "/__silences/"+created.ID, "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = serve("DELETE", "/__silences/"+created.ID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"message":"no active silence `+created.ID+`"}`, rr.Body.String())
+
+	rr = serve("GET", "/__silences", "")
+	assert.JSONEq(t, `[]`, rr.Body.String())
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	health "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/service-status-go/gtg"
+	"strings"
+	"time"
 )
 
-const healthPath = "/__health"
+const (
+	healthPath    = "/__health"
+	panicGuideURL = "https://dewey.ft.com/annotations-publish-healthchecker.html"
+)
 
 type healthService struct {
 	config        *healthConfig
@@ -21,65 +27,184 @@ type healthConfig struct {
 }
 
 func newHealthService(config *healthConfig, healthchecker *healthcheckerService) *healthService {
-	service := &healthService{config: config}
-	service.checks = []health.Check{
-		service.reachabilityCheck(),
-		service.failedTransactionsCheck(),
+	service := &healthService{config: config, healthchecker: healthchecker}
+	service.checks = []health.Check{service.reachabilityCheck(), service.freshnessCheck()}
+	for _, ct := range healthchecker.contentTypes {
+		service.checks = append(service.checks, service.failedTransactionsChecks(ct)...)
 	}
-	service.healthchecker = healthchecker
 
 	return service
 }
 
 func (service *healthService) reachabilityCheck() health.Check {
+	templates := service.healthchecker.alertTemplates()
 	return health.Check{
-		BusinessImpact:   "Shows whether this healthcheckerService can monitor the success of the annotations publishing",
+		BusinessImpact:   "Shows whether this healthcheckerService can monitor the success of the publishing flows",
 		Name:             "Splunk Event Reader is reachable",
-		PanicGuide:       "https://dewey.ft.com/annotations-publish-healthchecker.html",
+		PanicGuide:       panicGuideURL,
 		Severity:         1,
-		TechnicalSummary: "This check verifies whether the latest call to the splunk-event-reader was successful, hence the results are relevant",
+		TechnicalSummary: templates.render(templateReachabilityTechnicalSummary, templates.reachabilityContext(nil, "", "", "")),
 		Checker:          service.eventReaderIsReachable,
 	}
 }
 
 func (service *healthService) eventReaderIsReachable() (string, error) {
 
-	status := service.healthchecker.getHealthStatus().(healthStatus)
-	msg := fmt.Sprintf("Latest check at: %s", status.LastTimeCheck)
-	if status.Successful {
-		return fmt.Sprintf("Splunk Event Reader was reachable. %s", msg), nil
+	var unreachable []string
+	var lastTimeCheck string
+	for _, ct := range service.healthchecker.contentTypes {
+		status := service.healthchecker.getContentTypeHealthStatus(ct.ContentType)
+		if !status.Reachable {
+			unreachable = append(unreachable, ct.ContentType)
+		}
+		// content types are checked in their configured order, so the last one holds the latest check time
+		lastTimeCheck = status.LastTimeCheck
+	}
+
+	breaker := ""
+	if service.healthchecker.breaker != nil {
+		breaker = service.healthchecker.breaker.status().String()
+	}
+
+	templates := service.healthchecker.alertTemplates()
+	msg := templates.render(templateReachabilityOutput, templates.reachabilityContext(unreachable, lastTimeCheck, service.healthchecker.describeStreaks(), breaker))
+	if len(unreachable) == 0 {
+		return msg, nil
 	} else {
-		return "", fmt.Errorf("Splunk Event Reader was not reachable. %s", msg)
+		return "", errors.New(msg)
 	}
 }
 
-func (service *healthService) failedTransactionsCheck() health.Check {
+func (service *healthService) freshnessCheck() health.Check {
+	templates := service.healthchecker.alertTemplates()
 	return health.Check{
-		BusinessImpact:   "At least 2 publish failures were detected for the latest check. This will reflect in the SLA measurement.",
-		Name:             "Annotations Publish Failures",
-		PanicGuide:       "https://dewey.ft.com/annotations-publish-healthchecker.html",
+		BusinessImpact:   "The reported publish health may be outdated, so publish failures could go unnoticed",
+		Name:             "Health data is fresh",
+		PanicGuide:       panicGuideURL,
 		Severity:         1,
-		TechnicalSummary: "Annotations publishes failed. There is a degradation in the annotations publish or monitoring services. Check the /__details endpoint.",
-		Checker:          service.failedTransactionsChecker,
+		TechnicalSummary: templates.render(templateFreshnessTechnicalSummary, templates.freshnessContext(nil, service.healthchecker.staleAfter)),
+		Checker:          service.healthDataIsFresh,
 	}
 }
 
-func (service *healthService) failedTransactionsChecker() (string, error) {
+func (service *healthService) healthDataIsFresh() (string, error) {
 
-	status := service.healthchecker.getHealthStatus().(healthStatus)
-	msg := fmt.Sprintf("NO of failures: %d. Latest check at: %s", len(status.OpenTransactions), status.LastTimeCheck)
-	if len(status.OpenTransactions) >= 2 {
-		return "", fmt.Errorf("Degradation detected. %s", msg)
+	now := time.Now()
+	var stale []string
+	for _, ct := range service.healthchecker.contentTypes {
+		status := service.healthchecker.getContentTypeHealthStatus(ct.ContentType)
+		age := service.healthchecker.checkAge(status, now)
+		if service.healthchecker.isStale(age) {
+			stale = append(stale, fmt.Sprintf("%s (%s)", ct.ContentType, describeAge(status, age)))
+		}
+	}
+
+	templates := service.healthchecker.alertTemplates()
+	msg := templates.render(templateFreshnessOutput, templates.freshnessContext(stale, service.healthchecker.staleAfter))
+	if len(stale) == 0 {
+		return msg, nil
 	} else {
-		return fmt.Sprintf("No degradation detected. %s", msg), nil
+		return "", errors.New(msg)
+	}
+}
+
+func (service *healthService) failedTransactionsChecks(ct contentTypeConfig) []health.Check {
+
+	var checks []health.Check
+	for i, tier := range ct.failureTiers() {
+		checks = append(checks, service.failedTransactionsCheck(ct, i, tier))
+	}
+	return checks
+}
+
+func (service *healthService) failedTransactionsCheck(ct contentTypeConfig, tierIndex int, tier failureTier) health.Check {
+	templates := service.healthchecker.alertTemplates()
+	return health.Check{
+		BusinessImpact:   fmt.Sprintf("At least %d %s publish failures were detected for the latest check%s. This will reflect in the SLA measurement.", tier.Threshold, ct.ContentType, tier.describe()),
+		Name:             fmt.Sprintf("%s Publish Failures%s", displayName(ct.ContentType), tier.suffix()),
+		PanicGuide:       panicGuideURL,
+		Severity:         tier.Severity,
+		TechnicalSummary: templates.render(templateTechnicalSummary, templates.checkContext(ct, tier, false, healthStatus{})),
+		Checker: func() (string, error) {
+			return service.failedTransactionsChecker(ct, tierIndex)
+		},
+	}
+}
+
+// failedTransactionsChecker fails only for the highest tier reached by the number of failures,
+// so that /__health shows a single red check naming the tier that was hit.
+func (service *healthService) failedTransactionsChecker(ct contentTypeConfig, tierIndex int) (string, error) {
+
+	status := service.healthchecker.getContentTypeHealthStatus(ct.ContentType)
+	tiers := ct.failureTiers()
+	reached := ct.reachedTier(len(status.OpenTransactions))
+	templates := service.healthchecker.alertTemplates()
+
+	switch {
+	case reached == tierIndex:
+		return "", errors.New(templates.render(templateCheckOutput, templates.checkContext(ct, tiers[reached], true, status)))
+	case reached > tierIndex:
+		return templates.render(templateCheckOutput, templates.checkContext(ct, tiers[reached], true, status)), nil
+	default:
+		return templates.render(templateCheckOutput, templates.checkContext(ct, failureTier{}, false, status)), nil
+	}
+}
+
+// failureTiers returns the configured tiers, or a single critical tier built from the failure threshold.
+func (ct contentTypeConfig) failureTiers() []failureTier {
+	if len(ct.FailureTiers) > 0 {
+		return ct.FailureTiers
+	}
+	return []failureTier{{Threshold: ct.FailureThreshold, Severity: 1}}
+}
+
+// reachedTier returns the index of the highest tier reached by the given number of failures, or -1 if none was reached.
+func (ct contentTypeConfig) reachedTier(failures int) int {
+	reached := -1
+	for i, tier := range ct.failureTiers() {
+		if failures >= tier.Threshold {
+			reached = i
+		}
+	}
+	return reached
+}
+
+func (tier failureTier) suffix() string {
+	if tier.Name == "" {
+		return ""
 	}
+	return fmt.Sprintf(" (%s)", tier.Name)
+}
+
+func (tier failureTier) describe() string {
+	if tier.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s tier: at least %d failures, severity %d)", tier.Name, tier.Threshold, tier.Severity)
 }
 
 func (service *healthService) gtgCheck() gtg.Status {
 
-	if _, err := service.reachabilityCheck().Checker(); err != nil {
-		return gtg.Status{GoodToGo: false, Message: err.Error()}
+	for _, check := range []health.Check{service.reachabilityCheck(), service.freshnessCheck()} {
+		if _, err := check.Checker(); err != nil {
+			return gtg.Status{GoodToGo: false, Message: err.Error()}
+		}
 	}
 
 	return gtg.Status{GoodToGo: true}
 }
+
+func describeAge(status healthStatus, age time.Duration) string {
+	if status.checkedAt.IsZero() {
+		return "never checked"
+	}
+	return fmt.Sprintf("last checked %s ago", age/time.Second*time.Second)
+}
+
+// displayName turns a content type into the capitalised form used in check names, e.g. "annotations" -> "Annotations".
+func displayName(contentType string) string {
+	if contentType == "" {
+		return contentType
+	}
+	return strings.ToUpper(contentType[:1]) + contentType[1:]
+}
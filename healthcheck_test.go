@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	health "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,22 @@ import (
 	"time"
 )
 
+var annotationsConfig = contentTypeConfig{
+	ContentType:      "annotations",
+	EarliestTime:     mustParseRelativeTime(earliestTime),
+	LatestTime:       mustParseRelativeTime(latestTime),
+	SLAWindow:        2,
+	FailureThreshold: 2,
+}
+
+func newAnnotationsHealthchecker(eventReaderAddress string, status healthStatus) *healthcheckerService {
+	return &healthcheckerService{
+		source:         newEventReaderSource(eventReaderAddress, http.DefaultClient),
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{"annotations": status},
+	}
+}
+
 func TestEventReaderIsReachable(t *testing.T) {
 
 	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -21,9 +38,10 @@ func TestEventReaderIsReachable(t *testing.T) {
 	healthStatus := healthStatus{
 		LastTimeCheck: time.Now().Format(timestampFormat),
 		Successful:    true,
+		Reachable:     true,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
 	message, err := healthService.eventReaderIsReachable()
 
 	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was reachable. Latest check at: %s", healthStatus.LastTimeCheck), message)
@@ -44,10 +62,10 @@ func TestEventReaderIsNotReachable(t *testing.T) {
 		Successful:    false,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
 	message, err := healthService.eventReaderIsReachable()
 
-	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was not reachable. Latest check at: %s", healthStatus.LastTimeCheck), err.Error())
+	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was not reachable for annotations. Latest check at: %s", healthStatus.LastTimeCheck), err.Error())
 	assert.Empty(t, message)
 }
 
@@ -64,10 +82,11 @@ func TestFailedTransactionsChecker_0(t *testing.T) {
 		LastTimeCheck:    time.Now().Format(timestampFormat),
 		OpenTransactions: []transaction{},
 		Successful:       true,
+		Reachable:        true,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
-	message, err := healthService.failedTransactionsChecker()
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
+	message, err := healthService.failedTransactionsChecker(annotationsConfig, 0)
 
 	assert.Equal(t, fmt.Sprintf("No degradation detected. NO of failures: 0. Latest check at: %s", healthStatus.LastTimeCheck), message)
 	assert.Nil(t, err)
@@ -92,10 +111,11 @@ func TestFailedTransactionsChecker_1(t *testing.T) {
 			},
 		},
 		Successful: true,
+		Reachable:  true,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
-	message, err := healthService.failedTransactionsChecker()
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
+	message, err := healthService.failedTransactionsChecker(annotationsConfig, 0)
 
 	assert.Equal(t, fmt.Sprintf("No degradation detected. NO of failures: 1. Latest check at: %s", healthStatus.LastTimeCheck), message)
 	assert.Nil(t, err)
@@ -125,10 +145,11 @@ func TestFailedTransactionsChecker_2(t *testing.T) {
 			},
 		},
 		Successful: true,
+		Reachable:  true,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
-	message, err := healthService.failedTransactionsChecker()
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
+	message, err := healthService.failedTransactionsChecker(annotationsConfig, 0)
 
 	assert.Equal(t, fmt.Sprintf("Degradation detected. NO of failures: 2. Latest check at: %s", healthStatus.LastTimeCheck), err.Error())
 	assert.Empty(t, message)
@@ -152,9 +173,10 @@ func TestEventReader_GTG_Succeeds(t *testing.T) {
 			},
 		},
 		Successful: true,
+		Reachable:  true,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
 	status := healthService.gtgCheck()
 
 	assert.Empty(t, status.Message)
@@ -181,9 +203,141 @@ func TestEventReader_GTG_Fails(t *testing.T) {
 		Successful: false,
 	}
 
-	healthService := newHealthService(&healthConfig{}, &healthcheckerService{eventReaderAddress: healthcheckerServer.URL, healthStatus: healthStatus})
+	healthService := newHealthService(&healthConfig{}, newAnnotationsHealthchecker(healthcheckerServer.URL, healthStatus))
 	status := healthService.gtgCheck()
 
-	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was not reachable. Latest check at: %s", healthStatus.LastTimeCheck), status.Message)
+	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was not reachable for annotations. Latest check at: %s", healthStatus.LastTimeCheck), status.Message)
 	assert.Equal(t, false, status.GoodToGo)
 }
+
+func TestEventReaderIsNotReachable_MultipleContentTypes(t *testing.T) {
+
+	lastTimeCheck := time.Now().Format(timestampFormat)
+	contentConfig := contentTypeConfig{ContentType: "content", FailureThreshold: 1}
+	listsConfig := contentTypeConfig{ContentType: "lists", FailureThreshold: 1}
+
+	healthService := newHealthService(&healthConfig{}, &healthcheckerService{
+		contentTypes: []contentTypeConfig{annotationsConfig, contentConfig, listsConfig},
+		healthStatuses: map[string]healthStatus{
+			"annotations": {LastTimeCheck: lastTimeCheck, Successful: false},
+			"content":     {LastTimeCheck: lastTimeCheck, Successful: true, Reachable: true},
+			"lists":       {LastTimeCheck: lastTimeCheck, Successful: false},
+		},
+	})
+	message, err := healthService.eventReaderIsReachable()
+
+	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was not reachable for annotations, lists. Latest check at: %s", lastTimeCheck), err.Error())
+	assert.Empty(t, message)
+}
+
+func TestNewHealthService_ChecksPerContentType(t *testing.T) {
+
+	contentConfig := contentTypeConfig{ContentType: "content", FailureThreshold: 1}
+	lastTimeCheck := time.Now().Format(timestampFormat)
+
+	healthService := newHealthService(&healthConfig{}, &healthcheckerService{
+		contentTypes: []contentTypeConfig{annotationsConfig, contentConfig},
+		healthStatuses: map[string]healthStatus{
+			"annotations": {LastTimeCheck: lastTimeCheck, OpenTransactions: testTxs[:1], Successful: true, Reachable: true},
+			"content":     {LastTimeCheck: lastTimeCheck, OpenTransactions: testTxs[:1], Successful: true, Reachable: true},
+		},
+	})
+
+	assert.Len(t, healthService.checks, 4)
+	assert.Equal(t, "Splunk Event Reader is reachable", healthService.checks[0].Name)
+	assert.Equal(t, "Health data is fresh", healthService.checks[1].Name)
+	assert.Equal(t, "Annotations Publish Failures", healthService.checks[2].Name)
+	assert.Equal(t, "Content Publish Failures", healthService.checks[3].Name)
+
+	_, err := healthService.checks[2].Checker()
+	assert.NoError(t, err, "a single annotations failure is below the annotations threshold")
+
+	_, err = healthService.checks[3].Checker()
+	assert.EqualError(t, err, fmt.Sprintf("Degradation detected. NO of failures: 1. Latest check at: %s", lastTimeCheck))
+}
+
+func TestFailedTransactionsChecks_Tiers(t *testing.T) {
+
+	lastTimeCheck := time.Now().Format(timestampFormat)
+	tieredConfig := contentTypeConfig{
+		ContentType: "annotations",
+		FailureTiers: []failureTier{
+			{Name: "warning", Threshold: 1, Severity: 2},
+			{Name: "critical", Threshold: 2, Severity: 1},
+		},
+	}
+
+	var tests = []struct {
+		scenario    string
+		failures    []transaction
+		warningErr  string
+		criticalErr string
+	}{
+		{"No failures", []transaction{}, "", ""},
+		{"Warning tier", testTxs[:1], fmt.Sprintf("Degradation detected (warning tier: at least 1 failures, severity 2). NO of failures: 1. Latest check at: %s", lastTimeCheck), ""},
+		{"Critical tier", testTxs, "", fmt.Sprintf("Degradation detected (critical tier: at least 2 failures, severity 1). NO of failures: 2. Latest check at: %s", lastTimeCheck)},
+	}
+
+	for _, test := range tests {
+
+		healthService := newHealthService(&healthConfig{}, &healthcheckerService{
+			contentTypes:   []contentTypeConfig{tieredConfig},
+			healthStatuses: map[string]healthStatus{"annotations": {LastTimeCheck: lastTimeCheck, OpenTransactions: test.failures, Successful: true, Reachable: true}},
+		})
+
+		assert.Len(t, healthService.checks, 4, test.scenario)
+
+		warning := healthService.checks[2]
+		assert.Equal(t, "Annotations Publish Failures (warning)", warning.Name, test.scenario)
+		assert.Equal(t, uint8(2), warning.Severity, test.scenario)
+		assert.Contains(t, warning.BusinessImpact, "(warning tier: at least 1 failures, severity 2)", test.scenario)
+
+		critical := healthService.checks[3]
+		assert.Equal(t, "Annotations Publish Failures (critical)", critical.Name, test.scenario)
+		assert.Equal(t, uint8(1), critical.Severity, test.scenario)
+		assert.Contains(t, critical.TechnicalSummary, "(critical tier: at least 2 failures, severity 1)", test.scenario)
+
+		for _, c := range []struct {
+			check health.Check
+			err   string
+		}{{warning, test.warningErr}, {critical, test.criticalErr}} {
+			message, err := c.check.Checker()
+			if c.err == "" {
+				assert.NoError(t, err, test.scenario)
+				assert.NotEmpty(t, message, test.scenario)
+			} else {
+				assert.EqualError(t, err, c.err, test.scenario)
+			}
+		}
+	}
+}
+
+func TestHealthDataIsFresh(t *testing.T) {
+
+	now := time.Now()
+	healthchecker := &healthcheckerService{
+		contentTypes: []contentTypeConfig{annotationsConfig, {ContentType: "lists", FailureThreshold: 1}},
+		healthStatuses: map[string]healthStatus{
+			"annotations": {Successful: true, Reachable: true, checkedAt: now.Add(-30 * time.Second)},
+			"lists":       {Successful: true, Reachable: true, checkedAt: now.Add(-10 * time.Second)},
+		},
+		staleAfter: 3 * time.Minute,
+	}
+	healthService := newHealthService(&healthConfig{}, healthchecker)
+
+	message, err := healthService.healthDataIsFresh()
+	assert.NoError(t, err)
+	assert.Equal(t, "Health data is fresh. Results older than 3m0s are considered stale.", message)
+	assert.True(t, healthService.gtgCheck().GoodToGo)
+
+	healthchecker.healthStatuses["annotations"] = healthStatus{Successful: true, Reachable: true, checkedAt: now.Add(-5*time.Minute - 500*time.Millisecond)}
+	healthchecker.healthStatuses["lists"] = healthStatus{Successful: true, Reachable: true}
+
+	message, err = healthService.healthDataIsFresh()
+	assert.Empty(t, message)
+	assert.EqualError(t, err, "Health data is stale for annotations (last checked 5m0s ago), lists (never checked). Results older than 3m0s are considered stale.")
+
+	status := healthService.gtgCheck()
+	assert.False(t, status.GoodToGo)
+	assert.Contains(t, status.Message, "Health data is stale")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+type historyEntry struct {
+	Time     time.Time               `json:"time"`
+	Statuses map[string]healthStatus `json:"statuses"`
+}
+
+// historyStatus is a health status as served by /__history. The age and staleness of a result only make sense for the latest one,
+// in /__details, so they are left out of the past ones.
+type historyStatus struct {
+	healthStatus
+	CheckAgeSeconds *int64 `json:"event_reader_checking_age_seconds,omitempty"`
+	Stale           *bool  `json:"stale,omitempty"`
+}
+
+func (e historyEntry) MarshalJSON() ([]byte, error) {
+
+	statuses := make(map[string]historyStatus, len(e.Statuses))
+	for ct, status := range e.Statuses {
+		statuses[ct] = historyStatus{healthStatus: status}
+	}
+	return json.Marshal(struct {
+		Time     time.Time                `json:"time"`
+		Statuses map[string]historyStatus `json:"statuses"`
+	}{e.Time, statuses})
+}
+
+type historySummary struct {
+	Time               time.Time      `json:"time"`
+	FailedTransactions map[string]int `json:"failed_transactions"`
+	Unreachable        []string       `json:"event_reader_unreachable,omitempty"`
+}
+
+// healthHistory is a bounded ring buffer of the past health statuses.
+// The oldest entries are dropped when it is full, or when they get older than the maximum age.
+type healthHistory struct {
+	entries []historyEntry
+	next    int
+	count   int
+	maxAge  time.Duration
+	sync.RWMutex
+}
+
+func newHealthHistory(maxSize int, maxAge time.Duration) *healthHistory {
+	return &healthHistory{entries: make([]historyEntry, maxSize), maxAge: maxAge}
+}
+
+func (h *healthHistory) add(at time.Time, statuses map[string]healthStatus) {
+
+	h.Lock()
+	defer h.Unlock()
+
+	if len(h.entries) == 0 {
+		return
+	}
+
+	h.entries[h.next] = historyEntry{Time: at, Statuses: statuses}
+	h.next = (h.next + 1) % len(h.entries)
+	if h.count < len(h.entries) {
+		h.count++
+	}
+
+	h.prune(at)
+}
+
+// prune drops the entries that got older than the maximum age. It should be called with the lock held.
+func (h *healthHistory) prune(now time.Time) {
+
+	if h.maxAge <= 0 {
+		return
+	}
+
+	for h.count > 0 && now.Sub(h.entry(0).Time) > h.maxAge {
+		h.entries[h.index(0)] = historyEntry{}
+		h.count--
+	}
+}
+
+func (h *healthHistory) index(i int) int {
+	return (h.next - h.count + i + len(h.entries)) % len(h.entries)
+}
+
+func (h *healthHistory) entry(i int) historyEntry {
+	return h.entries[h.index(i)]
+}
+
+// query returns the entries between from and to (both inclusive, zero values meaning no bound), oldest first.
+// When limit is positive, only the latest limit entries are returned.
+func (h *healthHistory) query(from time.Time, to time.Time, limit int) []historyEntry {
+
+	h.RLock()
+	defer h.RUnlock()
+
+	now := time.Now()
+	res := []historyEntry{}
+	for i := 0; i < h.count; i++ {
+		e := h.entry(i)
+		if h.maxAge > 0 && now.Sub(e.Time) > h.maxAge {
+			continue
+		}
+		if !from.IsZero() && e.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && e.Time.After(to) {
+			continue
+		}
+		res = append(res, e)
+	}
+
+	if limit > 0 && len(res) > limit {
+		res = res[len(res)-limit:]
+	}
+	return res
+}
+
+func summarise(entries []historyEntry) []historySummary {
+
+	res := make([]historySummary, 0, len(entries))
+	for _, e := range entries {
+		summary := historySummary{Time: e.Time, FailedTransactions: map[string]int{}}
+		for ct, status := range e.Statuses {
+			summary.FailedTransactions[ct] = len(status.OpenTransactions)
+			if !status.Successful {
+				summary.Unreachable = append(summary.Unreachable, ct)
+			}
+		}
+		sort.Strings(summary.Unreachable)
+		res = append(res, summary)
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHealthHistory_BoundedBySize(t *testing.T) {
+
+	history := newHealthHistory(3, 0)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		history.add(now.Add(time.Duration(i)*time.Minute), map[string]healthStatus{"annotations": {OpenTransactions: testTxs[:i%2], Successful: true}})
+	}
+
+	entries := history.query(time.Time{}, time.Time{}, 0)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, now.Add(2*time.Minute), entries[0].Time)
+	assert.Equal(t, now.Add(3*time.Minute), entries[1].Time)
+	assert.Equal(t, now.Add(4*time.Minute), entries[2].Time)
+}
+
+func TestHealthHistory_BoundedByAge(t *testing.T) {
+
+	history := newHealthHistory(10, 30*time.Minute)
+	now := time.Now()
+
+	history.add(now.Add(-time.Hour), map[string]healthStatus{})
+	history.add(now.Add(-20*time.Minute), map[string]healthStatus{})
+	history.add(now.Add(-10*time.Minute), map[string]healthStatus{})
+
+	entries := history.query(time.Time{}, time.Time{}, 0)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, now.Add(-20*time.Minute), entries[0].Time)
+}
+
+func TestHealthHistory_Query(t *testing.T) {
+
+	history := newHealthHistory(10, 0)
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		history.add(now.Add(time.Duration(i)*time.Minute), map[string]healthStatus{})
+	}
+
+	entries := history.query(now.Add(time.Minute), now.Add(4*time.Minute), 0)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, now.Add(time.Minute), entries[0].Time)
+	assert.Equal(t, now.Add(4*time.Minute), entries[3].Time)
+
+	entries = history.query(now.Add(time.Minute), now.Add(4*time.Minute), 2)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, now.Add(3*time.Minute), entries[0].Time)
+	assert.Equal(t, now.Add(4*time.Minute), entries[1].Time)
+}
+
+func TestHealthHistory_Disabled(t *testing.T) {
+
+	history := newHealthHistory(0, 0)
+	history.add(time.Now(), map[string]healthStatus{})
+
+	assert.Empty(t, history.query(time.Time{}, time.Time{}, 0))
+}
+
+func TestSummarise(t *testing.T) {
+
+	now := time.Now()
+	summaries := summarise([]historyEntry{
+		{Time: now, Statuses: map[string]healthStatus{
+			"annotations": {OpenTransactions: testTxs, Successful: true},
+			"lists":       {OpenTransactions: []transaction{}, Successful: false},
+			"content":     {OpenTransactions: []transaction{}, Successful: false},
+		}},
+	})
+
+	assert.Equal(t, []historySummary{{
+		Time:               now,
+		FailedTransactions: map[string]int{"annotations": 2, "lists": 0, "content": 0},
+		Unreachable:        []string{"content", "lists"},
+	}}, summaries)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/Financial-Times/go-logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+type trackedTransaction struct {
+	transaction
+	FirstSeen  string `json:"first_seen"`
+	LastSeen   string `json:"last_seen"`
+	TimesSeen  int    `json:"times_seen"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+	firstSeen  time.Time
+}
+
+// failureTracker follows the failed transactions of a content type across the checks.
+// A failure that disappears while its start time is still inside the checking window was closed in the meantime,
+// hence it is resolved. One that disappears because it left the window is forgotten.
+type failureTracker struct {
+	tracked map[string]*trackedTransaction
+	sync.Mutex
+}
+
+func newFailureTracker() *failureTracker {
+	return &failureTracker{tracked: map[string]*trackedTransaction{}}
+}
+
+// update records the result of the latest check, and fills in the new, ongoing and resolved failures of the status.
+// Unsuccessful checks tell nothing about the transactions, so they leave the tracked failures untouched.
+func (ft *failureTracker) update(status healthStatus, windowStart time.Time) healthStatus {
+
+	ft.Lock()
+	defer ft.Unlock()
+
+	now := status.checkedAt
+	seenAt := now.Format(timestampFormat)
+
+	if status.Successful {
+		open := map[string]bool{}
+		for _, tx := range status.OpenTransactions {
+			open[tx.TransactionID] = true
+
+			tracked, found := ft.tracked[tx.TransactionID]
+			if !found {
+				tracked = &trackedTransaction{transaction: tx, FirstSeen: seenAt, firstSeen: now}
+				ft.tracked[tx.TransactionID] = tracked
+				logger.WithTransactionID(tx.TransactionID).WithUUID(tx.UUID).Infof("New publish failure detected at %s.", seenAt)
+			}
+			tracked.LastSeen = seenAt
+			tracked.TimesSeen++
+			tracked.ResolvedAt = ""
+		}
+
+		for tid, tracked := range ft.tracked {
+			if open[tid] {
+				continue
+			}
+
+			txTime, err := time.Parse(timestampFormat, tracked.LastModified)
+			if err == nil && txTime.Before(windowStart) {
+				if tracked.ResolvedAt == "" {
+					logger.WithTransactionID(tid).WithUUID(tracked.UUID).Warnf("Publish failure left the checking window without being closed.")
+				}
+				delete(ft.tracked, tid)
+				continue
+			}
+
+			if tracked.ResolvedAt == "" {
+				tracked.ResolvedAt = seenAt
+				logger.WithTransactionID(tid).WithUUID(tracked.UUID).Infof("Publish failure was resolved at %s.", seenAt)
+			}
+		}
+	}
+
+	status.New, status.Ongoing, status.Resolved = []trackedTransaction{}, []trackedTransaction{}, []trackedTransaction{}
+	for _, tracked := range ft.tracked {
+		switch {
+		case tracked.ResolvedAt != "":
+			status.Resolved = append(status.Resolved, *tracked)
+		case tracked.TimesSeen == 1:
+			status.New = append(status.New, *tracked)
+		default:
+			status.Ongoing = append(status.Ongoing, *tracked)
+		}
+	}
+	sortTracked(status.New)
+	sortTracked(status.Ongoing)
+	sortTracked(status.Resolved)
+
+	return status
+}
+
+func sortTracked(txs []trackedTransaction) {
+	sort.Slice(txs, func(i, j int) bool {
+		if !txs[i].firstSeen.Equal(txs[j].firstSeen) {
+			return txs[i].firstSeen.Before(txs[j].firstSeen)
+		}
+		return txs[i].TransactionID < txs[j].TransactionID
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFailureTracker_Lifecycle(t *testing.T) {
+
+	start, err := time.Parse(timestampFormat, "2017-02-13T12:00:00.000Z")
+	assert.NoError(t, err)
+
+	tx1 := transaction{TransactionID: "tid1", UUID: "uuid1", LastModified: "2017-02-13T11:50:00.000Z"}
+	tx2 := transaction{TransactionID: "tid2", UUID: "uuid2", LastModified: "2017-02-13T11:52:00.000Z"}
+	tracker := newFailureTracker()
+
+	check := func(minutes int, successful bool, txs ...transaction) healthStatus {
+		now := start.Add(time.Duration(minutes) * time.Minute)
+		status := healthStatus{OpenTransactions: txs, Successful: successful, checkedAt: now}
+		return tracker.update(status, now.Add(-15*time.Minute))
+	}
+
+	// both failures show up as new
+	status := check(0, true, tx1, tx2)
+	assert.Equal(t, []string{"tid1", "tid2"}, trackedIDs(status.New))
+	assert.Empty(t, status.Ongoing)
+	assert.Empty(t, status.Resolved)
+
+	// tid1 is still open, tid2 got closed while still inside the window
+	status = check(1, true, tx1)
+	assert.Empty(t, status.New)
+	assert.Equal(t, []string{"tid1"}, trackedIDs(status.Ongoing))
+	assert.Equal(t, 2, status.Ongoing[0].TimesSeen)
+	assert.Equal(t, "2017-02-13T12:00:00Z", status.Ongoing[0].FirstSeen)
+	assert.Equal(t, "2017-02-13T12:01:00Z", status.Ongoing[0].LastSeen)
+	assert.Equal(t, []string{"tid2"}, trackedIDs(status.Resolved))
+	assert.Equal(t, "2017-02-13T12:01:00Z", status.Resolved[0].ResolvedAt)
+
+	// an unsuccessful check does not change anything
+	status = check(2, false)
+	assert.Equal(t, []string{"tid1"}, trackedIDs(status.Ongoing))
+	assert.Equal(t, []string{"tid2"}, trackedIDs(status.Resolved))
+
+	// tid1 left the window without being closed, tid2 stays resolved while inside the window
+	status = check(6, true)
+	assert.Empty(t, status.New)
+	assert.Empty(t, status.Ongoing)
+	assert.Equal(t, []string{"tid2"}, trackedIDs(status.Resolved))
+
+	// tid2 left the window as well
+	status = check(8, true)
+	assert.Empty(t, status.Resolved)
+	assert.Empty(t, tracker.tracked)
+}
+
+func TestFailureTracker_ReopenedFailure(t *testing.T) {
+
+	now := time.Now()
+	tx := transaction{TransactionID: "tid1", UUID: "uuid1", LastModified: now.Add(-10 * time.Minute).Format(timestampFormat)}
+	tracker := newFailureTracker()
+
+	tracker.update(healthStatus{OpenTransactions: []transaction{tx}, Successful: true, checkedAt: now}, now.Add(-15*time.Minute))
+	tracker.update(healthStatus{OpenTransactions: []transaction{}, Successful: true, checkedAt: now.Add(time.Minute)}, now.Add(-14*time.Minute))
+	status := tracker.update(healthStatus{OpenTransactions: []transaction{tx}, Successful: true, checkedAt: now.Add(2 * time.Minute)}, now.Add(-13*time.Minute))
+
+	assert.Empty(t, status.Resolved)
+	assert.Equal(t, []string{"tid1"}, trackedIDs(status.Ongoing))
+	assert.Equal(t, 2, status.Ongoing[0].TimesSeen)
+}
+
+func trackedIDs(txs []trackedTransaction) []string {
+	ids := []string{}
+	for _, tx := range txs {
+		ids = append(ids, tx.TransactionID)
+	}
+	return ids
+}
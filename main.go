@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/jawher/mow.cli"
 	"net/http"
 	"os"
@@ -8,6 +12,7 @@ import (
 	"sync"
 	"syscall"
 
+	"github.com/Financial-Times/annotations-publish-healthchecker/fakereader"
 	"github.com/Financial-Times/http-handlers-go/httphandlers"
 	"github.com/gorilla/mux"
 	"github.com/rcrowley/go-metrics"
@@ -21,8 +26,7 @@ import (
 const appDescription = "Service that reports whether the annotations publishing flow works as expected."
 
 func main() {
-	ticker := time.NewTicker(1 * time.Minute)
-	app := initApp(ticker)
+	app := initApp(1 * time.Minute)
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Errorf("App could not start, error=[%s]\n", err)
@@ -30,7 +34,7 @@ func main() {
 	}
 }
 
-func initApp(ticker *time.Ticker) *cli.Cli {
+func initApp(pollInterval time.Duration) *cli.Cli {
 	app := cli.App("annotations-publish-healthchecker", appDescription)
 
 	appSystemCode := app.String(cli.StringOpt{
@@ -54,6 +58,286 @@ func initApp(ticker *time.Ticker) *cli.Cli {
 		EnvVar: "SPLUNK_EVENT_READER",
 	})
 
+	sourceType := app.String(cli.StringOpt{
+		Name:   "source",
+		Value:  sourceEventReader,
+		Desc:   "Where the open transactions come from: event-reader to call the Splunk Event Reader, splunk to run searches through the Splunk REST API, events to correlate raw publish events in memory",
+		EnvVar: "SOURCE",
+	})
+
+	splunkURL := app.String(cli.StringOpt{
+		Name:   "splunk-url",
+		Value:  "",
+		Desc:   "Address of the Splunk REST API (management port) used by the splunk source, e.g. https://splunk.example.com:8089",
+		EnvVar: "SPLUNK_URL",
+	})
+
+	splunkToken := app.String(cli.StringOpt{
+		Name:   "splunk-token",
+		Value:  "",
+		Desc:   "Splunk authentication token used by the splunk source",
+		EnvVar: "SPLUNK_TOKEN",
+	})
+
+	splunkSearch := app.String(cli.StringOpt{
+		Name:   "splunk-search",
+		Value:  defaultSplunkSearch,
+		Desc:   "Default template of the search run by the splunk source, as a Go text/template given the {{.ContentType}}. Can be overridden per content type.",
+		EnvVar: "SPLUNK_SEARCH",
+	})
+
+	splunkPollInterval := app.Int(cli.IntOpt{
+		Name:   "splunk-poll-interval",
+		Value:  500,
+		Desc:   "Time between the polls of a Splunk search job until it is done. Given in milliseconds.",
+		EnvVar: "SPLUNK_POLL_INTERVAL",
+	})
+
+	splunkPageSize := app.Int(cli.IntOpt{
+		Name:   "splunk-page-size",
+		Value:  1000,
+		Desc:   "Number of results fetched at once from a Splunk search job",
+		EnvVar: "SPLUNK_PAGE_SIZE",
+	})
+
+	eventsFile := app.String(cli.StringOpt{
+		Name:   "events-file",
+		Value:  "",
+		Desc:   "NDJSON file of raw publish events read at startup with the events source, - for the standard input, which is followed until it ends",
+		EnvVar: "EVENTS_FILE",
+	})
+
+	eventsRetention := app.Int(cli.IntOpt{
+		Name:   "events-retention",
+		Value:  1440,
+		Desc:   "Time the raw publish events are kept in memory with the events source, it should cover the longest checking window. Given in minutes.",
+		EnvVar: "EVENTS_RETENTION",
+	})
+
+	eventReaderTimeout := app.Int(cli.IntOpt{
+		Name:   "event-reader-timeout",
+		Value:  10,
+		Desc:   "Timeout of the calls to the Splunk Event Reader. Given in seconds.",
+		EnvVar: "EVENT_READER_TIMEOUT",
+	})
+
+	eventReaderRetries := app.Int(cli.IntOpt{
+		Name:   "event-reader-retries",
+		Value:  2,
+		Desc:   "Number of times a call to the Splunk Event Reader is retried after a transport error or a 5xx response, 0 disables the retries",
+		EnvVar: "EVENT_READER_RETRIES",
+	})
+
+	eventReaderRetryBackoff := app.Int(cli.IntOpt{
+		Name:   "event-reader-retry-backoff",
+		Value:  500,
+		Desc:   "Backoff before the first retry of a call to the Splunk Event Reader, doubled for every further retry, with jitter. Given in milliseconds.",
+		EnvVar: "EVENT_READER_RETRY_BACKOFF",
+	})
+
+	eventReaderRetryMaxBackoff := app.Int(cli.IntOpt{
+		Name:   "event-reader-retry-max-backoff",
+		Value:  5000,
+		Desc:   "Maximum backoff between the retries of a call to the Splunk Event Reader. Given in milliseconds.",
+		EnvVar: "EVENT_READER_RETRY_MAX_BACKOFF",
+	})
+
+	breakerThreshold := app.Int(cli.IntOpt{
+		Name:   "event-reader-breaker-threshold",
+		Value:  5,
+		Desc:   "Number of consecutive failed fetches from the Splunk Event Reader, whatever their retries, after which the circuit breaker of the checks opens, 0 disables the circuit breaker",
+		EnvVar: "EVENT_READER_BREAKER_THRESHOLD",
+	})
+
+	breakerCoolDown := app.Int(cli.IntOpt{
+		Name:   "event-reader-breaker-cool-down",
+		Value:  120,
+		Desc:   "Time during which the calls to the Splunk Event Reader are suspended once the circuit breaker is open. Given in seconds.",
+		EnvVar: "EVENT_READER_BREAKER_COOL_DOWN",
+	})
+
+	unreachableAfter := app.Int(cli.IntOpt{
+		Name:   "unreachable-after",
+		Value:  3,
+		Desc:   "Number of consecutive failed checks after which the Splunk Event Reader is reported as unreachable",
+		EnvVar: "UNREACHABLE_AFTER",
+	})
+
+	reachableAfter := app.Int(cli.IntOpt{
+		Name:   "reachable-after",
+		Value:  2,
+		Desc:   "Number of consecutive successful checks after which the Splunk Event Reader is reported as reachable again",
+		EnvVar: "REACHABLE_AFTER",
+	})
+
+	checkRateLimit := app.Int(cli.IntOpt{
+		Name:   "check-rate-limit",
+		Value:  5,
+		Desc:   "Maximum number of on-demand checks started through POST /__check per minute",
+		EnvVar: "CHECK_RATE_LIMIT",
+	})
+
+	queryMaxRange := app.Int(cli.IntOpt{
+		Name:   "query-max-range",
+		Value:  1440,
+		Desc:   "Maximum length of the window of an ad-hoc query through GET /__query. Given in minutes.",
+		EnvVar: "QUERY_MAX_RANGE",
+	})
+
+	recordFile := app.String(cli.StringOpt{
+		Name:   "record-file",
+		Value:  "",
+		Desc:   "File where every call to the Splunk Event Reader is recorded as a JSON line, for the replay subcommand. Empty disables the recording.",
+		EnvVar: "RECORD_FILE",
+	})
+
+	recordMaxSize := app.Int(cli.IntOpt{
+		Name:   "record-max-size",
+		Value:  100,
+		Desc:   "Size after which the recording file is rotated. Given in megabytes.",
+		EnvVar: "RECORD_MAX_SIZE",
+	})
+
+	recordMaxFiles := app.Int(cli.IntOpt{
+		Name:   "record-max-files",
+		Value:  5,
+		Desc:   "Number of rotated recording files kept besides the current one",
+		EnvVar: "RECORD_MAX_FILES",
+	})
+
+	webhooks := app.String(cli.StringOpt{
+		Name:   "webhooks",
+		Value:  "",
+		Desc:   `JSON list of the webhooks notified of the changes of health, e.g. [{"url":"https://alerts.example.com/hook","timeout":10}]. The timeout is given in seconds and is optional.`,
+		EnvVar: "WEBHOOKS",
+	})
+
+	webhookTimeout := app.Int(cli.IntOpt{
+		Name:   "webhook-timeout",
+		Value:  5,
+		Desc:   "Default timeout of the calls to a webhook. Given in seconds.",
+		EnvVar: "WEBHOOK_TIMEOUT",
+	})
+
+	slackURL := app.String(cli.StringOpt{
+		Name:   "slack-url",
+		Value:  "",
+		Desc:   "Slack incoming webhook notified of the changes of health, or https://slack.com/api/chat.postMessage with a token and a channel to thread the messages of every incident. Empty disables Slack.",
+		EnvVar: "SLACK_URL",
+	})
+
+	slackToken := app.String(cli.StringOpt{
+		Name:   "slack-token",
+		Value:  "",
+		Desc:   "Slack bot token, needed with chat.postMessage",
+		EnvVar: "SLACK_TOKEN",
+	})
+
+	slackChannel := app.String(cli.StringOpt{
+		Name:   "slack-channel",
+		Value:  "",
+		Desc:   "Slack channel of the messages, needed with chat.postMessage",
+		EnvVar: "SLACK_CHANNEL",
+	})
+
+	slackMaxFailures := app.Int(cli.IntOpt{
+		Name:   "slack-max-failures",
+		Value:  10,
+		Desc:   "Maximum number of failed transactions listed in a Slack message",
+		EnvVar: "SLACK_MAX_FAILURES",
+	})
+
+	pagerDutyRoutingKey := app.String(cli.StringOpt{
+		Name:   "pagerduty-routing-key",
+		Value:  "",
+		Desc:   "Integration key of the PagerDuty service alerted when the publishes degrade. Empty disables PagerDuty.",
+		EnvVar: "PAGERDUTY_ROUTING_KEY",
+	})
+
+	pagerDutyURL := app.String(cli.StringOpt{
+		Name:   "pagerduty-url",
+		Value:  defaultPagerDutyURL,
+		Desc:   "Address of the PagerDuty Events API v2",
+		EnvVar: "PAGERDUTY_URL",
+	})
+
+	publicURL := app.String(cli.StringOpt{
+		Name:   "public-url",
+		Value:  "",
+		Desc:   "Public address of this service, used to link /__details from the notifications, e.g. https://upp-prod-publish.ft.com/__annotations-publish-healthchecker",
+		EnvVar: "PUBLIC_URL",
+	})
+
+	templatesFile := app.String(cli.StringOpt{
+		Name:   "templates",
+		Value:  "",
+		Desc:   "File of Go text/template definitions overriding the built-in texts of the publish failures checks and of the notifications",
+		EnvVar: "TEMPLATES",
+	})
+
+	environment := app.String(cli.StringOpt{
+		Name:   "environment",
+		Value:  "",
+		Desc:   "Name of the environment, given to the templates as .Environment",
+		EnvVar: "ENVIRONMENT",
+	})
+
+	notificationRetries := app.Int(cli.IntOpt{
+		Name:   "notification-retries",
+		Value:  3,
+		Desc:   "Number of times a failed notification is retried, 0 disables the retries",
+		EnvVar: "NOTIFICATION_RETRIES",
+	})
+
+	notificationRetryBackoff := app.Int(cli.IntOpt{
+		Name:   "notification-retry-backoff",
+		Value:  1000,
+		Desc:   "Backoff before the first retry of a notification, doubled for every further retry, with jitter. Given in milliseconds.",
+		EnvVar: "NOTIFICATION_RETRY_BACKOFF",
+	})
+
+	silenceMaxDuration := app.Int(cli.IntOpt{
+		Name:   "silence-max-duration",
+		Value:  10080,
+		Desc:   "Maximum time a failed transaction can be silenced through POST /__silences. Given in minutes.",
+		EnvVar: "SILENCE_MAX_DURATION",
+	})
+
+	staleAfter := app.Int(cli.IntOpt{
+		Name:   "stale-after",
+		Value:  3,
+		Desc:   "Number of poll intervals after which the latest health check results are considered stale",
+		EnvVar: "STALE_AFTER",
+	})
+
+	historySize := app.Int(cli.IntOpt{
+		Name:   "history-size",
+		Value:  1440,
+		Desc:   "Maximum number of past check results kept for the /__history endpoint, 0 disables the history",
+		EnvVar: "HISTORY_SIZE",
+	})
+
+	historyMaxAge := app.Int(cli.IntOpt{
+		Name:   "history-max-age",
+		Value:  1440,
+		Desc:   "Maximum age of the past check results kept for the /__history endpoint. Given in minutes, 0 means no limit.",
+		EnvVar: "HISTORY_MAX_AGE",
+	})
+
+	earliest := app.String(cli.StringOpt{
+		Name:   "earliest-time",
+		Value:  earliestTime,
+		Desc:   "Start of the checking window, as a Splunk relative time (e.g. -15m, -1h@h). Can be overridden per content type.",
+		EnvVar: "EARLIEST_TIME",
+	})
+
+	latest := app.String(cli.StringOpt{
+		Name:   "latest-time",
+		Value:  latestTime,
+		Desc:   "End of the checking window, as a Splunk relative time (e.g. -5m, -300s). Can be overridden per content type.",
+		EnvVar: "LATEST_TIME",
+	})
+
 	slaWindow := app.Int(cli.IntOpt{
 		Name:   "sla-window",
 		Value:  2,
@@ -61,6 +345,20 @@ func initApp(ticker *time.Ticker) *cli.Cli {
 		EnvVar: "SLA_WINDOW",
 	})
 
+	failureTiers := app.String(cli.StringOpt{
+		Name:   "failure-tiers",
+		Value:  "",
+		Desc:   `JSON list of the default failure tiers, e.g. [{"name":"warning","threshold":1,"severity":2},{"name":"critical","threshold":10,"severity":1}]. When empty, a single severity 1 tier is used with the failure threshold of each content type.`,
+		EnvVar: "FAILURE_TIERS",
+	})
+
+	contentTypes := app.String(cli.StringOpt{
+		Name:   "content-types",
+		Value:  defaultContentTypes,
+		Desc:   "JSON list of the monitored content types. Each entry needs a contentType and can override earliestTime, latestTime, slaWindow, failureThreshold and failureTiers.",
+		EnvVar: "CONTENT_TYPES",
+	})
+
 	port := app.String(cli.StringOpt{
 		Name:   "port",
 		Value:  "8083",
@@ -69,20 +367,347 @@ func initApp(ticker *time.Ticker) *cli.Cli {
 	})
 
 	log.InitLogger(*appSystemCode, "info")
-	log.Infof("[Startup] annotations-publish-healthchecker is starting ")
+
+	// newService builds the service from the options. The calls to the event reader go through the given transport,
+	// or through the default one, recorded if asked, when it is nil.
+	newService := func(transport http.RoundTripper) (*healthcheckerService, error) {
+
+		defaults := contentTypeConfig{SLAWindow: *slaWindow, FailureThreshold: defaultFailureThreshold}
+		if err := defaults.EarliestTime.UnmarshalText([]byte(*earliest)); err != nil {
+			return nil, fmt.Errorf("invalid earliest time: %v", err)
+		}
+		if err := defaults.LatestTime.UnmarshalText([]byte(*latest)); err != nil {
+			return nil, fmt.Errorf("invalid latest time: %v", err)
+		}
+
+		tiers, err := parseFailureTiers(*failureTiers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid failure tiers: %v", err)
+		}
+		defaults.FailureTiers = tiers
+
+		configs, err := parseContentTypes(*contentTypes, defaults)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content types configuration: %v", err)
+		}
+
+		if *historySize < 0 || *historyMaxAge < 0 {
+			return nil, errors.New("history size and max age should not be negative")
+		}
+
+		if *eventReaderRetries < 0 || *eventReaderRetryBackoff < 0 || *eventReaderRetryMaxBackoff < 0 {
+			return nil, errors.New("event reader retries and backoffs should not be negative")
+		}
+
+		if *breakerThreshold < 0 || *breakerCoolDown < 0 {
+			return nil, errors.New("circuit breaker threshold and cool-down should not be negative")
+		}
+
+		if *unreachableAfter < 1 || *reachableAfter < 1 {
+			return nil, errors.New("unreachable after and reachable after should be at least 1")
+		}
+
+		if *queryMaxRange < 1 {
+			return nil, errors.New("query max range should be at least 1 minute")
+		}
+
+		if *checkRateLimit < 1 {
+			return nil, errors.New("check rate limit should be at least 1")
+		}
+
+		if *recordMaxSize < 1 || *recordMaxFiles < 0 {
+			return nil, errors.New("record max size should be at least 1 megabyte and record max files should not be negative")
+		}
+
+		if *eventsRetention < 1 {
+			return nil, errors.New("events retention should be at least 1 minute")
+		}
+
+		if *silenceMaxDuration < 1 {
+			return nil, errors.New("silence max duration should be at least 1 minute")
+		}
+
+		if *staleAfter < 1 {
+			return nil, errors.New("stale after should be at least 1 poll interval")
+		}
+
+		templates, err := loadAlertTemplates(*templatesFile, *environment, *publicURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid templates: %v", err)
+		}
+
+		var source TransactionSource
+		var breaker *circuitBreaker
+		var correlator *eventCorrelator
+		switch *sourceType {
+		case sourceEventReader:
+			if transport == nil && *recordFile != "" {
+				file, err := openRotatingFile(*recordFile, int64(*recordMaxSize)*1024*1024, *recordMaxFiles)
+				if err != nil {
+					return nil, fmt.Errorf("cannot open the record file: %v", err)
+				}
+				log.Infof("Recording the calls to the Splunk Event Reader in %s", *recordFile)
+				transport = newRecordingTransport(nil, file)
+			}
+
+			source = newEventReaderSource(*eventReader, &http.Client{Timeout: time.Duration(*eventReaderTimeout) * time.Second, Transport: transport})
+		case sourceSplunk:
+			if *splunkURL == "" || *splunkToken == "" {
+				return nil, errors.New("the splunk source needs a Splunk URL and token")
+			}
+			if *splunkPollInterval < 1 || *splunkPageSize < 1 {
+				return nil, errors.New("Splunk poll interval and page size should be at least 1")
+			}
+			splunk, err := newSplunkSource(*splunkURL, *splunkToken, *splunkSearch, configs, time.Duration(*splunkPollInterval)*time.Millisecond, *splunkPageSize, &http.Client{Timeout: time.Duration(*eventReaderTimeout) * time.Second})
+			if err != nil {
+				return nil, err
+			}
+			source = splunk
+		case sourceEvents:
+			correlator = newEventCorrelator(time.Duration(*eventsRetention) * time.Minute)
+			if *eventsFile != "" {
+				if err := correlator.readEvents(*eventsFile, os.Stdin); err != nil {
+					return nil, fmt.Errorf("cannot read the events: %v", err)
+				}
+			}
+			source = correlator
+		default:
+			return nil, fmt.Errorf("unknown source %q, use %s, %s or %s", *sourceType, sourceEventReader, sourceSplunk, sourceEvents)
+		}
+
+		// the events source never fails, the checks of the remote ones are protected by the circuit breaker
+		if correlator == nil && *breakerThreshold > 0 {
+			breaker = newCircuitBreaker(source, *breakerThreshold, time.Duration(*breakerCoolDown)*time.Second)
+		}
+
+		s := &healthcheckerService{
+			source:  source,
+			breaker: breaker,
+			events:  correlator,
+			retries: retryPolicy{
+				retries:    *eventReaderRetries,
+				backoff:    time.Duration(*eventReaderRetryBackoff) * time.Millisecond,
+				maxBackoff: time.Duration(*eventReaderRetryMaxBackoff) * time.Millisecond,
+			},
+			checkBudget:      pollInterval,
+			unreachableAfter: *unreachableAfter,
+			reachableAfter:   *reachableAfter,
+			contentTypes:     configs,
+			healthStatuses:   map[string]healthStatus{},
+			trackers:         map[string]*failureTracker{},
+			staleAfter:       time.Duration(*staleAfter) * pollInterval,
+			history:          newHealthHistory(*historySize, time.Duration(*historyMaxAge)*time.Minute),
+			checkLimiter:     newRateLimiter(*checkRateLimit, time.Minute),
+			queryMaxRange:    time.Duration(*queryMaxRange) * time.Minute,
+			templates:        templates,
+			silences:         newSilenceStore(time.Duration(*silenceMaxDuration) * time.Minute),
+		}
+		s.metrics = newPublishMetrics(s.getOverruns)
+		return s, nil
+	}
+
+	app.Command("check", "Runs a single check against the event reader and prints the results. Exits with 0 when healthy, 1 when degraded, 2 when the event reader is unreachable and 3 when the check could not run.", func(cmd *cli.Cmd) {
+
+		format := cmd.String(cli.StringOpt{
+			Name:  "format",
+			Value: checkFormatTable,
+			Desc:  "Output format: table or json",
+		})
+
+		cmd.Action = func() {
+			// keep the standard output for the results
+			log.Logger().Out = os.Stderr
+
+			if *format != checkFormatTable && *format != checkFormatJSON {
+				log.Errorf("Unknown format %q, use %s or %s", *format, checkFormatTable, checkFormatJSON)
+				cli.Exit(exitCheckError)
+			}
+
+			s, err := newService(nil)
+			if err != nil {
+				log.Errorf("Invalid configuration: %v", err)
+				cli.Exit(exitCheckError)
+			}
+			cli.Exit(runCheckCommand(s, *format, os.Stdout))
+		}
+	})
+
+	app.Command("report", "Replays the checks over a past period and reports the failed publishes, e.g. for SLA reviews.", func(cmd *cli.Cmd) {
+
+		start := cmd.String(cli.StringOpt{
+			Name: "start",
+			Desc: "Time of the first replayed check, as an RFC3339 timestamp",
+		})
+
+		end := cmd.String(cli.StringOpt{
+			Name: "end",
+			Desc: "Time of the last replayed check, as an RFC3339 timestamp. Defaults to now.",
+		})
+
+		step := cmd.Int(cli.IntOpt{
+			Name:  "step",
+			Value: 60,
+			Desc:  "Time between the replayed checks. Given in minutes.",
+		})
+
+		format := cmd.String(cli.StringOpt{
+			Name:  "format",
+			Value: reportFormatMarkdown,
+			Desc:  "Output format: markdown, csv or json",
+		})
+
+		cmd.Action = func() {
+			// keep the standard output for the report
+			log.Logger().Out = os.Stderr
+
+			from, to, err := parseReportPeriod(*start, *end, time.Now())
+			if err != nil {
+				log.Errorf("Invalid report period: %v", err)
+				cli.Exit(1)
+			}
+			if *step < 1 {
+				log.Errorf("Report step should be at least 1 minute")
+				cli.Exit(1)
+			}
+			if *format != reportFormatMarkdown && *format != reportFormatCSV && *format != reportFormatJSON {
+				log.Errorf("Unknown format %q, use %s, %s or %s", *format, reportFormatMarkdown, reportFormatCSV, reportFormatJSON)
+				cli.Exit(1)
+			}
+
+			s, err := newService(nil)
+			if err != nil {
+				log.Errorf("Invalid configuration: %v", err)
+				cli.Exit(1)
+			}
+
+			report := buildReport(context.Background(), s.source, s.retries, s.contentTypes, from, to, time.Duration(*step)*time.Minute)
+			if err := writeReport(os.Stdout, report, *format); err != nil {
+				log.Errorf("Failed to write the report: %v", err)
+				cli.Exit(1)
+			}
+		}
+	})
+
+	app.Command("replay", "Runs the checks again over the calls recorded with --record-file, and prints the health statuses of every check as a JSON line.", func(cmd *cli.Cmd) {
+
+		recording := cmd.String(cli.StringOpt{
+			Name: "recording",
+			Desc: "Recording file to replay, along with its rotated files. Defaults to the record file.",
+		})
+
+		cmd.Action = func() {
+			// keep the standard output for the results
+			log.Logger().Out = os.Stderr
+
+			// only the calls to the event reader are recorded, the other sources would run against their live backend
+			if *sourceType != sourceEventReader {
+				log.Errorf("Cannot replay the %s source, only the calls of the %s source are recorded", *sourceType, sourceEventReader)
+				cli.Exit(1)
+			}
+
+			path := *recording
+			if path == "" {
+				path = *recordFile
+			}
+			if path == "" {
+				log.Errorf("No recording to replay, set --recording")
+				cli.Exit(1)
+			}
+
+			recs, err := loadRecordings(path, *recordMaxFiles)
+			if err != nil {
+				log.Errorf("Invalid recording: %v", err)
+				cli.Exit(1)
+			}
+
+			replay := newReplayTransport(recs)
+			s, err := newService(replay)
+			if err != nil {
+				log.Errorf("Invalid configuration: %v", err)
+				cli.Exit(1)
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			err = replayChecks(s, replay, pollInterval, func(check replayedCheck) error {
+				return encoder.Encode(check)
+			})
+			if err != nil {
+				log.Errorf("Replay stopped: %v", err)
+				cli.Exit(1)
+			}
+		}
+	})
+
+	app.Command("fake-reader", "Serves scripted responses in place of the Splunk Event Reader, to demo or test the alerting without Splunk.", func(cmd *cli.Cmd) {
+
+		scenarioFile := cmd.String(cli.StringOpt{
+			Name: "scenario",
+			Desc: "YAML or JSON file scripting the responses of every content type. Without it, no open transactions are served.",
+		})
+
+		fakePort := cmd.String(cli.StringOpt{
+			Name:  "port",
+			Value: "8084",
+			Desc:  "Port to listen on",
+		})
+
+		cmd.Action = func() {
+			scenario := fakereader.Scenario{}
+			if *scenarioFile != "" {
+				var err error
+				scenario, err = fakereader.Load(*scenarioFile)
+				if err != nil {
+					log.Errorf("Invalid scenario: %v", err)
+					cli.Exit(1)
+				}
+			}
+
+			log.Infof("Fake Splunk Event Reader listening on port %s with %d scripted content type(s)", *fakePort, len(scenario.ContentTypes))
+			handler := httphandlers.TransactionAwareRequestLoggingHandler(log.Logger(), fakereader.New(scenario))
+			if err := http.ListenAndServe(":"+*fakePort, handler); err != nil {
+				log.Errorf("Fake Splunk Event Reader stopped: %v", err)
+				cli.Exit(1)
+			}
+		}
+	})
 
 	app.Action = func() {
+		log.Infof("[Startup] annotations-publish-healthchecker is starting ")
 		log.Infof("System code: %s, App Name: %s, Port: %s", *appSystemCode, *appName, *port)
 
-		s := healthcheckerService{
-			eventReaderAddress: *eventReader,
-			healthStatus:       healthStatus{},
-			slaWindow:          *slaWindow,
+		s, err := newService(nil)
+		if err != nil {
+			log.Errorf("Invalid configuration: %v", err)
+			cli.Exit(1)
+		}
+
+		if *webhookTimeout < 1 || *notificationRetries < 0 || *notificationRetryBackoff < 0 || *slackMaxFailures < 1 {
+			log.Errorf("Invalid configuration: webhook timeout and Slack max failures should be at least 1, notification retries and backoff should not be negative")
+			cli.Exit(1)
 		}
-		s.monitorPublishHealth(ticker)
+		notifiers, err := parseWebhooks(*webhooks, time.Duration(*webhookTimeout)*time.Second)
+		if err != nil {
+			log.Errorf("Invalid configuration: %v", err)
+			cli.Exit(1)
+		}
+		if *slackURL != "" {
+			notifiers = append(notifiers, newSlackNotifier(*slackURL, *slackToken, *slackChannel, *publicURL, *slackMaxFailures, &http.Client{Timeout: time.Duration(*webhookTimeout) * time.Second}))
+		}
+		if *pagerDutyRoutingKey != "" {
+			notifiers = append(notifiers, newPagerDutyNotifier(*pagerDutyURL, *pagerDutyRoutingKey, *appSystemCode, *publicURL, &http.Client{Timeout: time.Duration(*webhookTimeout) * time.Second}))
+		}
+		if len(notifiers) > 0 {
+			log.Infof("Notifying %d destination(s) of the changes of health", len(notifiers))
+			s.notifications = newNotificationDispatcher(notifiers, retryPolicy{
+				retries:    *notificationRetries,
+				backoff:    time.Duration(*notificationRetryBackoff) * time.Millisecond,
+				maxBackoff: time.Minute,
+			}, s.templates)
+		}
+		s.monitorPublishHealth(time.NewTicker(pollInterval))
 
 		go func() {
-			routeRequests(*appSystemCode, *appName, *port, &s)
+			routeRequests(*appSystemCode, *appName, *port, s)
 		}()
 
 		waitForSignal()
@@ -109,10 +734,21 @@ func routeRequests(appSystemCode string, appName string, port string, healthchec
 	serveMux.HandleFunc(healthPath, health.Handler(hc))
 	serveMux.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(healthService.gtgCheck))
 	serveMux.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
+	serveMux.HandleFunc(metricsPath, healthchecker.metrics.handler)
 
-	handler := requestHandler{healthchecker}
+	handler := requestHandler{healthchecker: healthchecker, checker: healthchecker, querier: healthchecker, history: healthchecker.history, silences: healthchecker.silences}
 	servicesRouter := mux.NewRouter()
 	servicesRouter.HandleFunc("/__details", handler.getHealthDetails).Methods("GET")
+	servicesRouter.HandleFunc("/__history", handler.getHistory).Methods("GET")
+	servicesRouter.HandleFunc("/__check", handler.runCheck).Methods("POST")
+	servicesRouter.HandleFunc("/__query", handler.queryTransactions).Methods("GET")
+	servicesRouter.HandleFunc("/__silences", handler.createSilence).Methods("POST")
+	servicesRouter.HandleFunc("/__silences", handler.listSilences).Methods("GET")
+	servicesRouter.HandleFunc("/__silences/{id}", handler.deleteSilence).Methods("DELETE")
+	if healthchecker.events != nil {
+		handler.events = healthchecker.events
+		servicesRouter.HandleFunc("/__events", handler.ingestEvents).Methods("POST")
+	}
 
 	var monitoringRouter http.Handler = servicesRouter
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(log.Logger(), monitoringRouter)
@@ -143,7 +779,7 @@ func routeRequests(appSystemCode string, appName string, port string, healthchec
 }
 
 func waitForSignal() {
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	<-ch
 }
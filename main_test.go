@@ -65,10 +65,11 @@ func TestMain(m *testing.M) {
 	args := []string{
 		`--port=8083`,
 		fmt.Sprintf(`--event-reader=%s`, healthcheckerServer.URL),
+		`--unreachable-after=1`,
+		`--reachable-after=1`,
 	}
 
-	ticker := time.NewTicker(checkingPeriodInMillis * time.Millisecond)
-	app := initApp(ticker)
+	app := initApp(checkingPeriodInMillis * time.Millisecond)
 
 	go func() {
 		app.Run(args)
@@ -151,8 +152,8 @@ func Test_GetHealth(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, test.expectedStatus, res.StatusCode)
 
-		rBody := make([]byte, res.ContentLength)
-		res.Body.Read(rBody)
+		rBody, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
 		res.Body.Close()
 
 		health := fthealth.HealthResult{}
@@ -170,13 +171,13 @@ func Test_GetDetails(t *testing.T) {
 		errorIsExp      bool
 	}{
 		{url: "http://localhost:8083/__details", expectedStatus: http.StatusOK,
-			expHealthStatus: healthStatus{[]transaction{}, "", fmt.Sprintf("Between %s and %s", earliestTime, latestTime), true},
+			expHealthStatus: healthStatus{OpenTransactions: []transaction{}, CheckingPeriod: fmt.Sprintf("Between %s and %s", earliestTime, latestTime), Successful: true},
 			expectedHealth:  true, errorIsExp: false},
 		{url: "http://localhost:8083/__details", expectedStatus: http.StatusOK,
-			expHealthStatus: healthStatus{[]transaction{}, "", fmt.Sprintf("Between %s and %s", earliestTime, latestTime), false},
+			expHealthStatus: healthStatus{OpenTransactions: []transaction{}, CheckingPeriod: fmt.Sprintf("Between %s and %s", earliestTime, latestTime), Successful: false},
 			expectedHealth:  false, errorIsExp: true},
 		{url: "http://localhost:8083/__details", expectedStatus: http.StatusOK,
-			expHealthStatus: healthStatus{testTxs, "", fmt.Sprintf("Between %s and %s", earliestTime, latestTime), true},
+			expHealthStatus: healthStatus{OpenTransactions: testTxs, CheckingPeriod: fmt.Sprintf("Between %s and %s", earliestTime, latestTime), Successful: true},
 			expectedHealth:  false, errorIsExp: false},
 	}
 
@@ -199,10 +200,49 @@ func Test_GetDetails(t *testing.T) {
 		b, err := ioutil.ReadAll(res.Body)
 		assert.NoError(t, err)
 
-		var actHealthStatus healthStatus
-		err = json.Unmarshal(b, &actHealthStatus)
+		var actHealthStatuses map[string]healthStatus
+		err = json.Unmarshal(b, &actHealthStatuses)
 		assert.NoError(t, err)
 
+		assert.Len(t, actHealthStatuses, 1)
+
+		// the check runs on the live clock: its time is only known to be recent
+		actHealthStatus := actHealthStatuses["annotations"]
+		checkedAt, err := time.Parse(timestampFormat, actHealthStatus.LastTimeCheck)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), checkedAt, 10*time.Second)
+		test.expHealthStatus.LastTimeCheck = actHealthStatus.LastTimeCheck
 		assertEqual(t, test.expHealthStatus, actHealthStatus)
 	}
 }
+
+func Test_GetMetrics(t *testing.T) {
+
+	res, err := http.Get("http://localhost:8083/metrics")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	b, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `annotations_publish_healthchecker_checks_total{content_type="annotations"}`)
+}
+
+func Test_PostCheck(t *testing.T) {
+
+	testFlags.Lock()
+	testFlags.error = false
+	testFlags.healthyFlow = false
+	testFlags.Unlock()
+
+	res, err := http.Post("http://localhost:8083/__check", "application/json", nil)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var statuses map[string]healthStatus
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&statuses))
+	assert.Equal(t, testTxs, statuses["annotations"].OpenTransactions)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	metricsPath        = "/metrics"
+	metricsPrefix      = "annotations_publish_healthchecker_"
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// publishMetrics holds the publish health metrics, exported in the Prometheus text exposition format.
+type publishMetrics struct {
+	failedTransactions  map[string]int
+	reachable           map[string]bool
+	lastSuccessfulCheck map[string]float64
+	checks              map[string]uint64
+	checkErrors         map[string]map[string]uint64
+	latency             map[string]*histogram
+	overruns            func() uint64
+	sync.Mutex
+}
+
+func newPublishMetrics(overruns func() uint64) *publishMetrics {
+	return &publishMetrics{
+		failedTransactions:  map[string]int{},
+		reachable:           map[string]bool{},
+		lastSuccessfulCheck: map[string]float64{},
+		checks:              map[string]uint64{},
+		checkErrors:         map[string]map[string]uint64{},
+		latency:             map[string]*histogram{},
+		overruns:            overruns,
+	}
+}
+
+// observe records the result of a single check of the given content type.
+func (m *publishMetrics) observe(contentType string, status healthStatus) {
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.checks[contentType]++
+	m.reachable[contentType] = status.Successful
+
+	if status.Successful {
+		m.failedTransactions[contentType] = len(status.OpenTransactions)
+		m.lastSuccessfulCheck[contentType] = float64(status.checkedAt.UnixNano()) / 1e9
+	} else {
+		if m.checkErrors[contentType] == nil {
+			m.checkErrors[contentType] = map[string]uint64{}
+		}
+		m.checkErrors[contentType][status.failureReason]++
+	}
+
+	// every attempt of a retried fetch is a request of its own, unless it could not even be created
+	for _, attempt := range status.fetchAttempts {
+		if attempt.err != nil && failureReasonOf(attempt.err) == failureReasonRequest {
+			continue
+		}
+		h, found := m.latency[contentType]
+		if !found {
+			h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+			m.latency[contentType] = h
+		}
+		seconds := attempt.duration.Seconds()
+		for i, bound := range latencyBuckets {
+			if seconds <= bound {
+				h.counts[i]++
+			}
+		}
+		h.count++
+		h.sum += seconds
+	}
+}
+
+func (m *publishMetrics) write(w io.Writer) error {
+
+	m.Lock()
+	defer m.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, "failed_transactions", "gauge", "Number of failed transactions found by the latest successful check.")
+	for _, ct := range sortedKeys(m.failedTransactions) {
+		writeSample(bw, "failed_transactions", labels("content_type", ct), float64(m.failedTransactions[ct]))
+	}
+
+	writeHeader(bw, "event_reader_reachable", "gauge", "Whether the splunk-event-reader was reachable by the latest check (1) or not (0).")
+	for _, ct := range sortedKeys(m.reachable) {
+		value := 0.0
+		if m.reachable[ct] {
+			value = 1
+		}
+		writeSample(bw, "event_reader_reachable", labels("content_type", ct), value)
+	}
+
+	writeHeader(bw, "last_successful_check_timestamp_seconds", "gauge", "Unix time of the latest successful check.")
+	for _, ct := range sortedKeys(m.lastSuccessfulCheck) {
+		writeSample(bw, "last_successful_check_timestamp_seconds", labels("content_type", ct), m.lastSuccessfulCheck[ct])
+	}
+
+	writeHeader(bw, "checks_total", "counter", "Number of checks run.")
+	for _, ct := range sortedKeys(m.checks) {
+		writeSample(bw, "checks_total", labels("content_type", ct), float64(m.checks[ct]))
+	}
+
+	writeHeader(bw, "check_errors_total", "counter", "Number of checks that could not determine the publish health, by reason.")
+	for _, ct := range sortedKeys(m.checkErrors) {
+		for _, reason := range sortedKeys(m.checkErrors[ct]) {
+			writeSample(bw, "check_errors_total", labels("content_type", ct, "reason", reason), float64(m.checkErrors[ct][reason]))
+		}
+	}
+
+	if m.overruns != nil {
+		writeHeader(bw, "check_overruns_total", "counter", "Number of checks skipped because the previous one was still running.")
+		writeSample(bw, "check_overruns_total", "", float64(m.overruns()))
+	}
+
+	writeHeader(bw, "event_reader_request_duration_seconds", "histogram", "Duration of the requests to the splunk-event-reader.")
+	for _, ct := range sortedKeys(m.latency) {
+		h := m.latency[ct]
+		for i, bound := range latencyBuckets {
+			writeSample(bw, "event_reader_request_duration_seconds_bucket", labels("content_type", ct, "le", formatFloat(bound)), float64(h.counts[i]))
+		}
+		writeSample(bw, "event_reader_request_duration_seconds_bucket", labels("content_type", ct, "le", "+Inf"), float64(h.count))
+		writeSample(bw, "event_reader_request_duration_seconds_sum", labels("content_type", ct), h.sum)
+		writeSample(bw, "event_reader_request_duration_seconds_count", labels("content_type", ct), float64(h.count))
+	}
+
+	return bw.Flush()
+}
+
+func (m *publishMetrics) handler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", metricsContentType)
+	if err := m.write(writer); err != nil {
+		logger.WithError(err).Warnf("Failed to write the metrics")
+	}
+}
+
+func writeHeader(w io.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", metricsPrefix, name, metricType)
+}
+
+func writeSample(w io.Writer, name string, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s%s %s\n", metricsPrefix, name, labels, formatFloat(value))
+}
+
+// labels formats name/value pairs as a Prometheus label set, e.g. {content_type="annotations"}.
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escapeLabelValue(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
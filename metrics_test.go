@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublishMetrics_Write(t *testing.T) {
+
+	checkedAt := time.Unix(1513694586, 500000000)
+	metrics := newPublishMetrics(func() uint64 { return 3 })
+
+	requestErr := &fetchError{reason: failureReasonRequest, err: errors.New("invalid URL")}
+
+	metrics.observe("annotations", healthStatus{OpenTransactions: testTxs, Successful: true, checkedAt: checkedAt, fetchAttempts: []fetchAttempt{{duration: 200 * time.Millisecond}}})
+	// a retried fetch observes every attempt, without the backoff between them
+	metrics.observe("annotations", healthStatus{OpenTransactions: []transaction{}, Successful: false, checkedAt: checkedAt.Add(time.Minute), failureReason: failureReasonStatus,
+		fetchAttempts: []fetchAttempt{{duration: 2 * time.Second, err: transportErr}, {duration: time.Second, err: status503Err}}})
+	metrics.observe("lists", healthStatus{OpenTransactions: []transaction{}, Successful: false, checkedAt: checkedAt, failureReason: failureReasonRequest, fetchAttempts: []fetchAttempt{{err: requestErr}}})
+
+	var buf bytes.Buffer
+	assert.NoError(t, metrics.write(&buf))
+
+	assert.Equal(t, `# HELP annotations_publish_healthchecker_failed_transactions Number of failed transactions found by the latest successful check.
+# TYPE annotations_publish_healthchecker_failed_transactions gauge
+annotations_publish_healthchecker_failed_transactions{content_type="annotations"} 2
+# HELP annotations_publish_healthchecker_event_reader_reachable Whether the splunk-event-reader was reachable by the latest check (1) or not (0).
+# TYPE annotations_publish_healthchecker_event_reader_reachable gauge
+annotations_publish_healthchecker_event_reader_reachable{content_type="annotations"} 0
+annotations_publish_healthchecker_event_reader_reachable{content_type="lists"} 0
+# HELP annotations_publish_healthchecker_last_successful_check_timestamp_seconds Unix time of the latest successful check.
+# TYPE annotations_publish_healthchecker_last_successful_check_timestamp_seconds gauge
+annotations_publish_healthchecker_last_successful_check_timestamp_seconds{content_type="annotations"} 1.5136945865e+09
+# HELP annotations_publish_healthchecker_checks_total Number of checks run.
+# TYPE annotations_publish_healthchecker_checks_total counter
+annotations_publish_healthchecker_checks_total{content_type="annotations"} 2
+annotations_publish_healthchecker_checks_total{content_type="lists"} 1
+# HELP annotations_publish_healthchecker_check_errors_total Number of checks that could not determine the publish health, by reason.
+# TYPE annotations_publish_healthchecker_check_errors_total counter
+annotations_publish_healthchecker_check_errors_total{content_type="annotations",reason="status"} 1
+annotations_publish_healthchecker_check_errors_total{content_type="lists",reason="request"} 1
+# HELP annotations_publish_healthchecker_check_overruns_total Number of checks skipped because the previous one was still running.
+# TYPE annotations_publish_healthchecker_check_overruns_total counter
+annotations_publish_healthchecker_check_overruns_total 3
+# HELP annotations_publish_healthchecker_event_reader_request_duration_seconds Duration of the requests to the splunk-event-reader.
+# TYPE annotations_publish_healthchecker_event_reader_request_duration_seconds histogram
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="0.05"} 0
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="0.1"} 0
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="0.25"} 1
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="0.5"} 1
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="1"} 2
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="2.5"} 3
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="5"} 3
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="10"} 3
+annotations_publish_healthchecker_event_reader_request_duration_seconds_bucket{content_type="annotations",le="+Inf"} 3
+annotations_publish_healthchecker_event_reader_request_duration_seconds_sum{content_type="annotations"} 3.2
+annotations_publish_healthchecker_event_reader_request_duration_seconds_count{content_type="annotations"} 3
+`, buf.String())
+}
+
+func TestPublishMetrics_Handler(t *testing.T) {
+
+	metrics := newPublishMetrics(nil)
+	metrics.observe("con\"tent", healthStatus{OpenTransactions: []transaction{}, Successful: true, checkedAt: time.Now()})
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", metricsPath, nil)
+	http.HandlerFunc(metrics.handler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, metricsContentType, rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `annotations_publish_healthchecker_failed_transactions{content_type="con\"tent"} 0`)
+	assert.NotContains(t, rr.Body.String(), "check_overruns_total")
+}
@@ -1,10 +1,28 @@
 package main
 
+import "time"
+
 type healthStatus struct {
-	OpenTransactions []transaction `json:"failed_transactions"`
-	CheckingPeriod   string        `json:"event_reader_checking_period"`
-	LastTimeCheck    string        `json:"event_reader_checking_time"`
-	Successful       bool          `json:"event_reader_was_reachable"`
+	OpenTransactions []transaction         `json:"failed_transactions"`
+	CheckingPeriod   string                `json:"event_reader_checking_period"`
+	LastTimeCheck    string                `json:"event_reader_checking_time"`
+	Successful       bool                  `json:"event_reader_was_reachable"`
+	Reachable        bool                  `json:"event_reader_reachable_hysteresis"`
+	FailureStreak    int                   `json:"event_reader_failure_streak"`
+	SuccessStreak    int                   `json:"event_reader_success_streak"`
+	Attempts         int                   `json:"event_reader_attempts,omitempty"`
+	Error            string                `json:"event_reader_error,omitempty"`
+	CircuitBreaker   *breakerStatus        `json:"event_reader_circuit_breaker,omitempty"`
+	CheckAgeSeconds  int64                 `json:"event_reader_checking_age_seconds"`
+	Stale            bool                  `json:"stale"`
+	New              []trackedTransaction  `json:"new"`
+	Ongoing          []trackedTransaction  `json:"ongoing"`
+	Resolved         []trackedTransaction  `json:"resolved"`
+	Silenced         []silencedTransaction `json:"silenced_transactions,omitempty"`
+	checkedAt        time.Time
+	failureReason    string
+	// the calls made to the event reader by the check, each timed on its own
+	fetchAttempts []fetchAttempt
 }
 
 type transaction struct {
@@ -14,3 +32,19 @@ type transaction struct {
 }
 
 type transactions []transaction
+
+type contentTypeConfig struct {
+	ContentType      string        `json:"contentType"`
+	EarliestTime     relativeTime  `json:"earliestTime"`
+	LatestTime       relativeTime  `json:"latestTime"`
+	SLAWindow        int           `json:"slaWindow"`
+	FailureThreshold int           `json:"failureThreshold"`
+	FailureTiers     []failureTier `json:"failureTiers"`
+	SplunkSearch     string        `json:"splunkSearch"`
+}
+
+type failureTier struct {
+	Name      string `json:"name"`
+	Threshold int    `json:"threshold"`
+	Severity  uint8  `json:"severity"`
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"strings"
+	"time"
+)
+
+// the changes of health that are notified
+const (
+	changeDegraded          = "degraded"
+	changeRecovered         = "recovered"
+	changeReaderUnreachable = "reader_unreachable"
+	changeReaderRecovered   = "reader_recovered"
+)
+
+// notificationQueueSize is the number of notifications waiting for a destination, further ones are dropped
+const notificationQueueSize = 100
+
+// healthChange is a change of the health of a content type, as sent to the notifiers.
+// The changes of a degradation, or of an unreachable event reader, share the same incident from the start to the recovery.
+type healthChange struct {
+	Event              string        `json:"event"`
+	ContentType        string        `json:"content_type"`
+	Incident           string        `json:"incident"`
+	Time               string        `json:"time"`
+	CheckingPeriod     string        `json:"checking_period"`
+	FailureCount       int           `json:"failure_count"`
+	Tier               string        `json:"tier,omitempty"`
+	Severity           uint8         `json:"severity,omitempty"`
+	FailedTransactions []transaction `json:"failed_transactions"`
+	Error              string        `json:"event_reader_error,omitempty"`
+	Title              string        `json:"title"`
+	Summary            string        `json:"summary"`
+	Text               string        `json:"text"`
+	status             healthStatus
+	tier               failureTier
+}
+
+// notifier delivers the health changes to a destination, within its own timeout.
+type notifier interface {
+	destination() string
+	notify(ctx context.Context, change healthChange) error
+}
+
+// alertState is what was last notified about a content type.
+type alertState struct {
+	// index of the highest failure tier notified, -1 when healthy
+	tier                int
+	degradedIncident    string
+	unreachable         bool
+	unreachableIncident string
+	// the notifications of the ongoing incidents, never sent twice
+	sent map[string]bool
+}
+
+// refusal is an error of a destination that may refuse a notification for good, in which case sending it again is pointless.
+type refusal interface {
+	permanent() bool
+}
+
+// notificationDispatcher watches the results of the checks, and notifies the changes of health to every destination.
+// Every destination has its own queue and retries, so a slow one does not hold the others back.
+type notificationDispatcher struct {
+	states    map[string]*alertState
+	queues    []chan healthChange
+	retries   retryPolicy
+	templates *alertTemplates
+}
+
+func newNotificationDispatcher(notifiers []notifier, retries retryPolicy, templates *alertTemplates) *notificationDispatcher {
+
+	d := &notificationDispatcher{states: map[string]*alertState{}, retries: retries, templates: templates}
+	for _, n := range notifiers {
+		queue := make(chan healthChange, notificationQueueSize)
+		d.queues = append(d.queues, queue)
+		go d.deliverAll(n, queue)
+	}
+	return d
+}
+
+// observe compares the results of a check with what was last notified, and queues the changes.
+// It is called by a single check at a time.
+func (d *notificationDispatcher) observe(contentTypes []contentTypeConfig, statuses map[string]healthStatus) {
+
+	for _, ct := range contentTypes {
+		status, found := statuses[ct.ContentType]
+		if !found {
+			continue
+		}
+		for _, change := range d.changes(ct, status) {
+			d.enqueue(change)
+		}
+	}
+}
+
+func (d *notificationDispatcher) changes(ct contentTypeConfig, status healthStatus) []healthChange {
+
+	state, found := d.states[ct.ContentType]
+	if !found {
+		state = &alertState{tier: -1, sent: map[string]bool{}}
+		d.states[ct.ContentType] = state
+	}
+
+	var changes []healthChange
+	newChange := func(event string, incident string) healthChange {
+		return healthChange{
+			Event:              event,
+			ContentType:        ct.ContentType,
+			Incident:           incident,
+			Time:               status.LastTimeCheck,
+			CheckingPeriod:     status.CheckingPeriod,
+			FailureCount:       len(status.OpenTransactions),
+			FailedTransactions: status.OpenTransactions,
+			Error:              status.Error,
+			status:             status,
+		}
+	}
+
+	switch {
+	case !status.Reachable && !state.unreachable:
+		state.unreachable = true
+		state.unreachableIncident = incidentID(ct.ContentType, "unreachable", status.checkedAt)
+		changes = append(changes, newChange(changeReaderUnreachable, state.unreachableIncident))
+	case status.Reachable && state.unreachable:
+		state.unreachable = false
+		changes = append(changes, newChange(changeReaderRecovered, state.unreachableIncident))
+	}
+
+	// the failed transactions are only known when the event reader answered
+	if status.Successful {
+		reached := ct.reachedTier(len(status.OpenTransactions))
+		switch {
+		case reached >= 0 && state.tier < 0:
+			state.degradedIncident = incidentID(ct.ContentType, "degraded", status.checkedAt)
+			fallthrough
+		case reached > state.tier:
+			tier := ct.failureTiers()[reached]
+			change := newChange(changeDegraded, state.degradedIncident)
+			change.Tier = tier.Name
+			change.Severity = tier.Severity
+			change.tier = tier
+			changes = append(changes, change)
+		case reached < 0 && state.tier >= 0:
+			changes = append(changes, newChange(changeRecovered, state.degradedIncident))
+		}
+		state.tier = reached
+	}
+
+	var unsent []healthChange
+	for _, change := range changes {
+		key := change.Incident + "/" + change.Event + "/" + change.Tier
+		if state.sent[key] {
+			continue
+		}
+		state.sent[key] = true
+		unsent = append(unsent, d.templates.describe(change))
+	}
+	state.forget()
+	return unsent
+}
+
+// forget drops the notifications of the incidents that are over.
+func (state *alertState) forget() {
+	for key := range state.sent {
+		degraded := state.tier >= 0 && strings.HasPrefix(key, state.degradedIncident+"/")
+		unreachable := state.unreachable && strings.HasPrefix(key, state.unreachableIncident+"/")
+		if !degraded && !unreachable {
+			delete(state.sent, key)
+		}
+	}
+}
+
+func (d *notificationDispatcher) enqueue(change healthChange) {
+
+	logger.Infof("Notifying %s of %s (incident %s)", change.Event, change.ContentType, change.Incident)
+	for _, queue := range d.queues {
+		select {
+		case queue <- change:
+		default:
+			logger.Warnf("Dropping the %s notification of %s, too many notifications are waiting", change.Event, change.ContentType)
+		}
+	}
+}
+
+func (d *notificationDispatcher) deliverAll(n notifier, queue chan healthChange) {
+	for change := range queue {
+		d.deliver(n, change)
+	}
+}
+
+// deliver sends a notification, retrying on failure with a backoff. The responses refusing the notification are not retried.
+func (d *notificationDispatcher) deliver(n notifier, change healthChange) {
+
+	for attempt := 1; ; attempt++ {
+		err := n.notify(context.Background(), change)
+		if err == nil {
+			return
+		}
+
+		if r, ok := err.(refusal); ok && r.permanent() {
+			logger.WithError(err).Errorf("Failed to notify %s of %s, the notification was refused", n.destination(), change.Event)
+			return
+		}
+		if attempt > d.retries.retries {
+			logger.WithError(err).Errorf("Failed to notify %s of %s after %d attempt(s)", n.destination(), change.Event, attempt)
+			return
+		}
+		wait := d.retries.wait(attempt)
+		logger.WithError(err).Warnf("Attempt %d to notify %s of %s failed, retrying in %v", attempt, n.destination(), change.Event, wait)
+		time.Sleep(wait)
+	}
+}
+
+// detailsURL links the /__details endpoint of the service from its public address.
+func detailsURL(publicURL string) string {
+	return strings.TrimSuffix(publicURL, "/") + "/__details"
+}
+
+func incidentID(contentType string, kind string, at time.Time) string {
+	return fmt.Sprintf("%s-%s-%s", contentType, kind, at.UTC().Format("20060102T150405Z"))
+}
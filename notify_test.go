@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/Financial-Times/go-logger/test"
+)
+
+var notifyNow = time.Date(2018, 1, 15, 14, 30, 0, 0, time.UTC)
+
+// recordingNotifier keeps the notifications it receives, failing the first ones as asked.
+type recordingNotifier struct {
+	failures int
+	err      error
+	attempts int
+	changes  []healthChange
+	received chan healthChange
+	sync.Mutex
+}
+
+func newRecordingNotifier(failures int) *recordingNotifier {
+	return &recordingNotifier{failures: failures, received: make(chan healthChange, 10)}
+}
+
+func (n *recordingNotifier) destination() string {
+	return "recorder"
+}
+
+func (n *recordingNotifier) notify(ctx context.Context, change healthChange) error {
+
+	n.Lock()
+	defer n.Unlock()
+
+	n.attempts++
+	if n.attempts <= n.failures {
+		if n.err != nil {
+			return n.err
+		}
+		return errors.New("destination unavailable")
+	}
+	n.changes = append(n.changes, change)
+	n.received <- change
+	return nil
+}
+
+func checkedStatus(minute int, successful bool, reachable bool, failures int) healthStatus {
+
+	txs := []transaction{}
+	for i := 0; i < failures; i++ {
+		txs = append(txs, transaction{TransactionID: fmt.Sprintf("tid_%c", 'a'+i), UUID: fmt.Sprintf("uuid_%c", 'a'+i)})
+	}
+	at := notifyNow.Add(time.Duration(minute) * time.Minute)
+	return healthStatus{OpenTransactions: txs, Successful: successful, Reachable: reachable, checkedAt: at, LastTimeCheck: at.Format(timestampFormat)}
+}
+
+func TestNotificationDispatcher_Changes(t *testing.T) {
+
+	tieredConfig := contentTypeConfig{
+		ContentType: "annotations",
+		FailureTiers: []failureTier{
+			{Name: "warning", Threshold: 1, Severity: 2},
+			{Name: "critical", Threshold: 3, Severity: 1},
+		},
+	}
+
+	var tests = []struct {
+		scenario string
+		config   contentTypeConfig
+		statuses []healthStatus
+		expected []string
+	}{
+		{
+			scenario: "healthy",
+			config:   annotationsConfig,
+			statuses: []healthStatus{checkedStatus(0, true, true, 0), checkedStatus(1, true, true, 1)},
+			expected: []string{},
+		},
+		{
+			scenario: "persistent degradation is notified once",
+			config:   annotationsConfig,
+			statuses: []healthStatus{checkedStatus(0, true, true, 2), checkedStatus(1, true, true, 3), checkedStatus(2, true, true, 2), checkedStatus(3, true, true, 0)},
+			expected: []string{"annotations-degraded-20180115T143000Z degraded", "annotations-degraded-20180115T143000Z recovered"},
+		},
+		{
+			scenario: "a new degradation is a new incident",
+			config:   annotationsConfig,
+			statuses: []healthStatus{checkedStatus(0, true, true, 2), checkedStatus(1, true, true, 0), checkedStatus(2, true, true, 2)},
+			expected: []string{"annotations-degraded-20180115T143000Z degraded", "annotations-degraded-20180115T143000Z recovered", "annotations-degraded-20180115T143200Z degraded"},
+		},
+		{
+			scenario: "escalation is notified once per tier",
+			config:   tieredConfig,
+			statuses: []healthStatus{checkedStatus(0, true, true, 1), checkedStatus(1, true, true, 3), checkedStatus(2, true, true, 1), checkedStatus(3, true, true, 3), checkedStatus(4, true, true, 0)},
+			expected: []string{"annotations-degraded-20180115T143000Z degraded warning", "annotations-degraded-20180115T143000Z degraded critical", "annotations-degraded-20180115T143000Z recovered"},
+		},
+		{
+			scenario: "failed checks keep the degradation",
+			config:   annotationsConfig,
+			statuses: []healthStatus{checkedStatus(0, true, true, 2), checkedStatus(1, false, true, 0), checkedStatus(2, true, true, 2)},
+			expected: []string{"annotations-degraded-20180115T143000Z degraded"},
+		},
+		{
+			scenario: "unreachable event reader",
+			config:   annotationsConfig,
+			statuses: []healthStatus{checkedStatus(0, false, false, 0), checkedStatus(1, false, false, 0), checkedStatus(2, true, true, 0), checkedStatus(3, false, false, 0)},
+			expected: []string{"annotations-unreachable-20180115T143000Z reader_unreachable", "annotations-unreachable-20180115T143000Z reader_recovered", "annotations-unreachable-20180115T143300Z reader_unreachable"},
+		},
+		{
+			scenario: "recovery of the event reader with a degradation",
+			config:   annotationsConfig,
+			statuses: []healthStatus{checkedStatus(0, false, false, 0), checkedStatus(1, true, true, 2)},
+			expected: []string{"annotations-unreachable-20180115T143000Z reader_unreachable", "annotations-unreachable-20180115T143000Z reader_recovered", "annotations-degraded-20180115T143100Z degraded"},
+		},
+	}
+
+	for _, test := range tests {
+		d := newNotificationDispatcher(nil, retryPolicy{}, defaultAlertTemplates)
+
+		actual := []string{}
+		for _, status := range test.statuses {
+			for _, change := range d.changes(test.config, status) {
+				actual = append(actual, strings.TrimSpace(change.Incident+" "+change.Event+" "+change.Tier))
+			}
+		}
+		assert.Equal(t, test.expected, actual, test.scenario)
+	}
+}
+
+func TestNotificationDispatcher_ChangeContent(t *testing.T) {
+
+	d := newNotificationDispatcher(nil, retryPolicy{}, defaultAlertTemplates)
+	status := checkedStatus(0, true, true, 2)
+	status.CheckingPeriod = "Between -15m and -5m"
+
+	changes := d.changes(annotationsConfig, status)
+
+	assert.Len(t, changes, 1)
+	assert.Equal(t, status, changes[0].status)
+	assert.Equal(t, failureTier{Threshold: 2, Severity: 1}, changes[0].tier)
+	changes[0].status = healthStatus{}
+	changes[0].tier = failureTier{}
+	assert.Equal(t, []healthChange{{
+		Event:          changeDegraded,
+		ContentType:    "annotations",
+		Incident:       "annotations-degraded-20180115T143000Z",
+		Time:           "2018-01-15T14:30:00Z",
+		CheckingPeriod: "Between -15m and -5m",
+		FailureCount:   2,
+		Severity:       1,
+		FailedTransactions: []transaction{
+			{TransactionID: "tid_a", UUID: "uuid_a"},
+			{TransactionID: "tid_b", UUID: "uuid_b"},
+		},
+		Title:   "Annotations publish failures detected",
+		Summary: "Annotations publish failures detected. NO of failures: 2",
+		Text:    "*2* annotations publishes failed. Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m",
+	}}, changes)
+}
+
+func TestNotificationDispatcher_RetriesEveryDestination(t *testing.T) {
+
+	hook := logger.NewTestHook("annotations-publish-healthchecker")
+	flaky := newRecordingNotifier(2)
+	broken := newRecordingNotifier(10)
+	d := newNotificationDispatcher([]notifier{flaky, broken}, retryPolicy{retries: 2, backoff: time.Millisecond, jitter: noJitter}, defaultAlertTemplates)
+
+	d.observe([]contentTypeConfig{annotationsConfig}, map[string]healthStatus{"annotations": checkedStatus(0, true, true, 2)})
+
+	select {
+	case change := <-flaky.received:
+		assert.Equal(t, changeDegraded, change.Event)
+	case <-time.After(time.Second):
+		assert.Fail(t, "the notification was not delivered")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		broken.Lock()
+		attempts := broken.attempts
+		broken.Unlock()
+		if attempts == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	broken.Lock()
+	assert.Equal(t, 3, broken.attempts)
+	assert.Empty(t, broken.changes)
+	broken.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	failed := false
+	for _, entry := range hook.AllEntries() {
+		failed = failed || (entry.Level.String() == "error" && entry.Message == "Failed to notify recorder of degraded after 3 attempt(s)")
+	}
+	assert.True(t, failed, "the failed notification should be logged")
+}
+
+func TestNotificationDispatcher_DoesNotRetryRefusedNotifications(t *testing.T) {
+
+	hook := logger.NewTestHook("annotations-publish-healthchecker")
+	refusing := newRecordingNotifier(10)
+	refusing.err = &statusError{statusCode: 400}
+	limited := newRecordingNotifier(1)
+	limited.err = &statusError{statusCode: 429}
+	d := newNotificationDispatcher([]notifier{refusing, limited}, retryPolicy{retries: 2, backoff: time.Millisecond, jitter: noJitter}, defaultAlertTemplates)
+
+	d.observe([]contentTypeConfig{annotationsConfig}, map[string]healthStatus{"annotations": checkedStatus(0, true, true, 2)})
+
+	select {
+	case change := <-limited.received:
+		assert.Equal(t, changeDegraded, change.Event)
+	case <-time.After(time.Second):
+		assert.Fail(t, "the rate limited notification was not retried")
+	}
+
+	refused := false
+	deadline := time.Now().Add(time.Second)
+	for !refused && time.Now().Before(deadline) {
+		for _, entry := range hook.AllEntries() {
+			refused = refused || (entry.Level.String() == "error" && entry.Message == "Failed to notify recorder of degraded, the notification was refused")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, refused, "the refused notification should be logged")
+
+	time.Sleep(10 * time.Millisecond)
+	refusing.Lock()
+	assert.Equal(t, 1, refusing.attempts)
+	refusing.Unlock()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+const defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyNotifier triggers a PagerDuty alert through the Events API v2 when the publishes of a content type degrade,
+// and resolves it when they recover. The alert of an incident is updated in place on escalation, as it keeps the same dedup key.
+// The changes of reachability are left to the healthchecks.
+type pagerDutyNotifier struct {
+	url        string
+	routingKey string
+	source     string
+	detailsURL string
+	client     *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component"`
+	Class         string                 `json:"class"`
+	CustomDetails pagerDutyCustomDetails `json:"custom_details"`
+}
+
+type pagerDutyCustomDetails struct {
+	FailureCount       int           `json:"failure_count"`
+	FailedUUIDs        []string      `json:"failed_uuids"`
+	FailedTransactions []transaction `json:"failed_transactions"`
+	CheckingPeriod     string        `json:"checking_period"`
+	Tier               string        `json:"tier,omitempty"`
+	Incident           string        `json:"incident"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// newPagerDutyNotifier names the service sending the events by its system code, and links /__details when the public address of the service is given.
+func newPagerDutyNotifier(url string, routingKey string, source string, publicURL string, client *http.Client) *pagerDutyNotifier {
+
+	n := &pagerDutyNotifier{url: url, routingKey: routingKey, source: source, client: client}
+	if publicURL != "" {
+		n.detailsURL = detailsURL(publicURL)
+	}
+	return n
+}
+
+func (n *pagerDutyNotifier) destination() string {
+	return "PagerDuty"
+}
+
+func (n *pagerDutyNotifier) notify(ctx context.Context, change healthChange) error {
+
+	event, ok := n.event(change)
+	if !ok {
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, body)
+}
+
+// event maps a change to the event sent to PagerDuty, if any.
+func (n *pagerDutyNotifier) event(change healthChange) (pagerDutyEvent, bool) {
+
+	event := pagerDutyEvent{RoutingKey: n.routingKey, DedupKey: n.source + "/" + change.Incident}
+	switch change.Event {
+	case changeRecovered:
+		event.EventAction = "resolve"
+		return event, true
+	case changeDegraded:
+	default:
+		return event, false
+	}
+
+	uuids := []string{}
+	for _, tx := range change.FailedTransactions {
+		uuids = append(uuids, tx.UUID)
+	}
+
+	event.EventAction = "trigger"
+	event.Payload = &pagerDutyPayload{
+		Summary:   change.Summary,
+		Source:    n.source,
+		Severity:  pagerDutySeverity(change.Severity),
+		Timestamp: change.Time,
+		Component: change.ContentType,
+		Class:     "publish failures",
+		CustomDetails: pagerDutyCustomDetails{
+			FailureCount:       change.FailureCount,
+			FailedUUIDs:        uuids,
+			FailedTransactions: change.FailedTransactions,
+			CheckingPeriod:     change.CheckingPeriod,
+			Tier:               change.Tier,
+			Incident:           change.Incident,
+		},
+	}
+	event.Links = []pagerDutyLink{{Href: panicGuideURL, Text: "Panic guide"}}
+	if n.detailsURL != "" {
+		event.Links = append(event.Links, pagerDutyLink{Href: n.detailsURL, Text: "Details"})
+	}
+	return event, true
+}
+
+// pagerDutySeverity maps the severity of a failure tier, 1 being the most severe, to a PagerDuty one.
+func pagerDutySeverity(severity uint8) string {
+	switch severity {
+	case 1:
+		return "critical"
+	case 2:
+		return "error"
+	default:
+		return "warning"
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPagerDutyNotifier_TriggersAndResolves(t *testing.T) {
+
+	var events []pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &event); err != nil || event.RoutingKey != "routing-key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"success","message":"Event processed","dedup_key":"` + event.DedupKey + `"}`))
+	}))
+	defer server.Close()
+
+	n := newPagerDutyNotifier(server.URL, "routing-key", "annotations-publish-healthchecker", "https://upp.example.com/__annotations-publish-healthchecker", http.DefaultClient)
+	degraded := degradedChange
+	degraded.Severity = 2
+
+	for _, change := range []healthChange{degraded, {Event: changeReaderUnreachable, Incident: "annotations-unreachable-20180115T143000Z"}, recoveredChange} {
+		assert.NoError(t, n.notify(context.Background(), change))
+	}
+
+	assert.Equal(t, []pagerDutyEvent{
+		{
+			RoutingKey:  "routing-key",
+			EventAction: "trigger",
+			DedupKey:    "annotations-publish-healthchecker/annotations-degraded-20180115T143000Z",
+			Payload: &pagerDutyPayload{
+				Summary:   "Annotations publish failures detected (warning). NO of failures: 3",
+				Source:    "annotations-publish-healthchecker",
+				Severity:  "error",
+				Timestamp: "2018-01-15T14:30:00Z",
+				Component: "annotations",
+				Class:     "publish failures",
+				CustomDetails: pagerDutyCustomDetails{
+					FailureCount:       3,
+					FailedUUIDs:        []string{"uuid_a", "uuid_b", "uuid_c"},
+					FailedTransactions: degradedChange.FailedTransactions,
+					CheckingPeriod:     "Between -15m and -5m",
+					Tier:               "warning",
+					Incident:           "annotations-degraded-20180115T143000Z",
+				},
+			},
+			Links: []pagerDutyLink{
+				{Href: "https://dewey.ft.com/annotations-publish-healthchecker.html", Text: "Panic guide"},
+				{Href: "https://upp.example.com/__annotations-publish-healthchecker/__details", Text: "Details"},
+			},
+		},
+		{
+			RoutingKey:  "routing-key",
+			EventAction: "resolve",
+			DedupKey:    "annotations-publish-healthchecker/annotations-degraded-20180115T143000Z",
+		},
+	}, events)
+}
+
+func TestPagerDutyNotifier_Failure(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	n := newPagerDutyNotifier(server.URL, "routing-key", "annotations-publish-healthchecker", "", http.DefaultClient)
+	assert.EqualError(t, n.notify(context.Background(), degradedChange), "unexpected status code 429")
+}
+
+func TestPagerDutySeverity(t *testing.T) {
+	assert.Equal(t, "critical", pagerDutySeverity(1))
+	assert.Equal(t, "error", pagerDutySeverity(2))
+	assert.Equal(t, "warning", pagerDutySeverity(3))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// transactionQuery is an ad-hoc query for the failed transactions of a content type. Unset fields default to the content type configuration.
+type transactionQuery struct {
+	ContentType  string
+	EarliestTime relativeTime
+	LatestTime   relativeTime
+	SLAWindow    *int
+}
+
+type queryResult struct {
+	ContentType        string       `json:"content_type"`
+	EarliestTime       string       `json:"earliest_time"`
+	LatestTime         string       `json:"latest_time"`
+	SLAWindow          int          `json:"sla_window"`
+	QueryTime          string       `json:"query_time"`
+	Attempts           int          `json:"event_reader_attempts"`
+	FailedTransactions transactions `json:"failed_transactions"`
+}
+
+// invalidQueryError tells that the query was rejected before reaching the transaction source.
+type invalidQueryError struct {
+	msg string
+}
+
+func (e *invalidQueryError) Error() string {
+	return e.msg
+}
+
+// query runs the same fetch and filter logic as the checks for an arbitrary window, without touching the cached statuses.
+func (s *healthcheckerService) query(ctx context.Context, q transactionQuery) (interface{}, error) {
+
+	ct, found := s.contentTypeConfig(q.ContentType)
+	if !found {
+		var known []string
+		for _, c := range s.contentTypes {
+			known = append(known, c.ContentType)
+		}
+		return nil, &invalidQueryError{fmt.Sprintf("unknown content type %q, expected one of %s", q.ContentType, strings.Join(known, ", "))}
+	}
+
+	if q.EarliestTime.isSet() {
+		ct.EarliestTime = q.EarliestTime
+	}
+	if q.LatestTime.isSet() {
+		ct.LatestTime = q.LatestTime
+	}
+	if q.SLAWindow != nil {
+		ct.SLAWindow = *q.SLAWindow
+	}
+
+	now := time.Now()
+	if err := validateWindow(ct.EarliestTime, ct.LatestTime, now); err != nil {
+		return nil, &invalidQueryError{err.Error()}
+	}
+	earliest, latest := ct.EarliestTime.resolve(now), ct.LatestTime.resolve(now)
+	if s.queryMaxRange > 0 && latest.Sub(earliest) > s.queryMaxRange {
+		return nil, &invalidQueryError{fmt.Sprintf("the window from %s to %s is longer than the maximum of %v", ct.EarliestTime, ct.LatestTime, s.queryMaxRange)}
+	}
+
+	txs, attempts, err := fetchFailedTransactions(ctx, s.source, s.retries, ct, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return queryResult{
+		ContentType:        ct.ContentType,
+		EarliestTime:       earliest.Format(time.RFC3339),
+		LatestTime:         latest.Format(time.RFC3339),
+		SLAWindow:          ct.SLAWindow,
+		QueryTime:          now.Format(timestampFormat),
+		Attempts:           len(attempts),
+		FailedTransactions: txs,
+	}, nil
+}
+
+func (s *healthcheckerService) contentTypeConfig(contentType string) (contentTypeConfig, bool) {
+	for _, ct := range s.contentTypes {
+		if ct.ContentType == contentType {
+			return ct, true
+		}
+	}
+	return contentTypeConfig{}, false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newQueryService(source TransactionSource) *healthcheckerService {
+	return &healthcheckerService{
+		source:         source,
+		contentTypes:   []contentTypeConfig{annotationsConfig, {ContentType: "lists", EarliestTime: mustParseRelativeTime("-30m"), LatestTime: mustParseRelativeTime("-10m"), SLAWindow: 5}},
+		healthStatuses: map[string]healthStatus{"annotations": {Successful: true, Reachable: true}},
+		queryMaxRange:  24 * time.Hour,
+	}
+}
+
+func TestQuery(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	earliest := time.Now().UTC().Add(-2 * time.Hour).Truncate(time.Second)
+	latest := earliest.Add(30 * time.Minute)
+
+	txs := transactions{
+		{TransactionID: "tid1", LastModified: earliest.Add(10 * time.Minute).Format(timestampFormat)},
+		{TransactionID: "tid2", LastModified: latest.Add(-time.Minute).Format(timestampFormat)},
+	}
+	source := &fakeSource{txs: map[string]transactions{"annotations": txs, "lists": txs}}
+	service := newQueryService(source)
+	slaWindow := 2
+
+	var tests = []struct {
+		scenario string
+		query    transactionQuery
+		call     string
+		expected transactions
+	}{
+		{"Absolute window", transactionQuery{ContentType: "annotations", EarliestTime: absoluteTime(earliest), LatestTime: absoluteTime(latest)},
+			fmt.Sprintf("annotations %s %s", earliest.Format(time.RFC3339), latest.Format(time.RFC3339)), txs[:1]},
+		{"Absolute window without SLA window", transactionQuery{ContentType: "annotations", EarliestTime: absoluteTime(earliest), LatestTime: absoluteTime(latest), SLAWindow: new(int)},
+			fmt.Sprintf("annotations %s %s", earliest.Format(time.RFC3339), latest.Format(time.RFC3339)), txs},
+		{"Relative window", transactionQuery{ContentType: "lists", EarliestTime: mustParseRelativeTime("-3h"), SLAWindow: &slaWindow}, "lists -3h -10m", txs},
+		{"Content type defaults", transactionQuery{ContentType: "lists"}, "lists -30m -10m", txs},
+	}
+
+	for _, test := range tests {
+		source.calls = nil
+
+		res, err := service.query(context.Background(), test.query)
+
+		if assert.NoError(t, err, test.scenario) {
+			assert.Equal(t, test.expected, res.(queryResult).FailedTransactions, test.scenario)
+			assert.Equal(t, test.query.ContentType, res.(queryResult).ContentType, test.scenario)
+			assert.Equal(t, []string{test.call}, source.calls, test.scenario)
+		}
+	}
+
+	res, _ := service.query(context.Background(), tests[0].query)
+	assert.Equal(t, earliest.Format(time.RFC3339), res.(queryResult).EarliestTime)
+	assert.Equal(t, latest.Format(time.RFC3339), res.(queryResult).LatestTime)
+	assert.Equal(t, 2, res.(queryResult).SLAWindow)
+	assert.Equal(t, 1, res.(queryResult).Attempts)
+
+	// the cached statuses are left alone
+	assert.Equal(t, map[string]healthStatus{"annotations": {Successful: true, Reachable: true}}, service.healthStatuses)
+}
+
+func TestQuery_Invalid(t *testing.T) {
+
+	source := &fakeSource{}
+	service := newQueryService(source)
+	now := time.Now().UTC()
+
+	var tests = []struct {
+		scenario string
+		query    transactionQuery
+		err      string
+	}{
+		{"Unknown content type", transactionQuery{ContentType: "content"}, `unknown content type "content", expected one of annotations, lists`},
+		{"Empty window", transactionQuery{ContentType: "annotations", EarliestTime: mustParseRelativeTime("-5m"), LatestTime: mustParseRelativeTime("-15m")}, "earliest time -5m should be before latest time -15m"},
+		{"Future window", transactionQuery{ContentType: "annotations", LatestTime: absoluteTime(now.Add(time.Hour))}, "should not be in the future"},
+		{"Window too long", transactionQuery{ContentType: "annotations", EarliestTime: mustParseRelativeTime("-2d")}, "the window from -2d to -5m is longer than the maximum of 24h0m0s"},
+	}
+
+	for _, test := range tests {
+		_, err := service.query(context.Background(), test.query)
+
+		assert.IsType(t, &invalidQueryError{}, err, test.scenario)
+		assert.Contains(t, err.Error(), test.err, test.scenario)
+	}
+	assert.Empty(t, source.calls)
+}
+
+func TestQuery_FetchError(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	service := newQueryService(&fakeSource{errs: map[string]error{"annotations": status404Err}})
+
+	_, err := service.query(context.Background(), transactionQuery{ContentType: "annotations"})
+	assert.Equal(t, status404Err, err)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"strings"
+)
+
+// updateReachability applies hysteresis to the reachability of the event reader: a content type becomes unreachable
+// only after a streak of failed checks, and reachable again only after a streak of successful ones.
+// Content types are considered reachable until their first check.
+func (s *healthcheckerService) updateReachability(contentType string, previous healthStatus, found bool, status healthStatus) healthStatus {
+
+	status.Reachable = previous.Reachable || !found
+
+	if status.Successful {
+		status.SuccessStreak = previous.SuccessStreak + 1
+		if !status.Reachable && status.SuccessStreak >= s.getReachableAfter() {
+			status.Reachable = true
+			logger.Infof("Splunk Event Reader is reachable again for %s after %d successful checks.", contentType, status.SuccessStreak)
+		}
+	} else {
+		status.FailureStreak = previous.FailureStreak + 1
+		if status.Reachable && status.FailureStreak >= s.getUnreachableAfter() {
+			status.Reachable = false
+			logger.Warnf("Splunk Event Reader is unreachable for %s after %d failed checks.", contentType, status.FailureStreak)
+		}
+	}
+
+	return status
+}
+
+func (s *healthcheckerService) getUnreachableAfter() int {
+	if s.unreachableAfter < 1 {
+		return 1
+	}
+	return s.unreachableAfter
+}
+
+func (s *healthcheckerService) getReachableAfter() int {
+	if s.reachableAfter < 1 {
+		return 1
+	}
+	return s.reachableAfter
+}
+
+// describeStreaks describes the current streaks of the content types, or returns an empty string if none was checked yet.
+func (s *healthcheckerService) describeStreaks() string {
+
+	var streaks []string
+	for _, ct := range s.contentTypes {
+		status := s.getContentTypeHealthStatus(ct.ContentType)
+		if status.FailureStreak > 0 {
+			streaks = append(streaks, fmt.Sprintf("%s %d failed", ct.ContentType, status.FailureStreak))
+		} else if status.SuccessStreak > 0 {
+			streaks = append(streaks, fmt.Sprintf("%s %d successful", ct.ContentType, status.SuccessStreak))
+		}
+	}
+
+	if len(streaks) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Consecutive checks: %s (unreachable after %d failed, reachable again after %d successful).",
+		strings.Join(streaks, ", "), s.getUnreachableAfter(), s.getReachableAfter())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestUpdateReachability(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	service := &healthcheckerService{unreachableAfter: 3, reachableAfter: 2}
+
+	var tests = []struct {
+		successful    bool
+		reachable     bool
+		failureStreak int
+		successStreak int
+	}{
+		{false, true, 1, 0},
+		{false, true, 2, 0},
+		{true, true, 0, 1},
+		{false, true, 1, 0},
+		{false, true, 2, 0},
+		{false, false, 3, 0},
+		{false, false, 4, 0},
+		{true, false, 0, 1},
+		{false, false, 1, 0},
+		{true, false, 0, 1},
+		{true, true, 0, 2},
+		{true, true, 0, 3},
+	}
+
+	previous, found := healthStatus{}, false
+	for i, test := range tests {
+		status := service.updateReachability("annotations", previous, found, healthStatus{Successful: test.successful})
+
+		assert.Equal(t, test.reachable, status.Reachable, "check %d", i)
+		assert.Equal(t, test.failureStreak, status.FailureStreak, "check %d", i)
+		assert.Equal(t, test.successStreak, status.SuccessStreak, "check %d", i)
+		previous, found = status, true
+	}
+}
+
+func TestUpdateReachability_DefaultsToTheLatestCheck(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	service := &healthcheckerService{}
+
+	status := service.updateReachability("annotations", healthStatus{}, false, healthStatus{Successful: false})
+	assert.False(t, status.Reachable)
+
+	status = service.updateReachability("annotations", status, true, healthStatus{Successful: true})
+	assert.True(t, status.Reachable)
+}
+
+func TestEventReaderIsReachable_Streaks(t *testing.T) {
+
+	hook := logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{errs: map[string]error{"annotations": transportErr}}
+	service := &healthcheckerService{
+		source:           source,
+		contentTypes:     []contentTypeConfig{annotationsConfig, {ContentType: "lists", FailureThreshold: 1}},
+		healthStatuses:   map[string]healthStatus{},
+		unreachableAfter: 2,
+		reachableAfter:   2,
+	}
+	healthService := newHealthService(&healthConfig{}, service)
+
+	service.refreshHealthStatuses()
+	lastTimeCheck := service.getContentTypeHealthStatus("lists").LastTimeCheck
+	message, err := healthService.eventReaderIsReachable()
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Splunk Event Reader was reachable. Latest check at: %s. Consecutive checks: annotations 1 failed, lists 1 successful (unreachable after 2 failed, reachable again after 2 successful).", lastTimeCheck), message)
+	assert.True(t, healthService.gtgCheck().GoodToGo)
+
+	service.refreshHealthStatuses()
+	assert.Equal(t, "Splunk Event Reader is unreachable for annotations after 2 failed checks.", hook.LastEntry().Message)
+	lastTimeCheck = service.getContentTypeHealthStatus("lists").LastTimeCheck
+	_, err = healthService.eventReaderIsReachable()
+	assert.EqualError(t, err, fmt.Sprintf("Splunk Event Reader was not reachable for annotations. Latest check at: %s. Consecutive checks: annotations 2 failed, lists 2 successful (unreachable after 2 failed, reachable again after 2 successful).", lastTimeCheck))
+	assert.False(t, healthService.gtgCheck().GoodToGo)
+
+	source.Lock()
+	source.errs = nil
+	source.Unlock()
+
+	service.refreshHealthStatuses()
+	status := service.getHealthStatus().(map[string]healthStatus)["annotations"]
+	assert.False(t, status.Reachable)
+	assert.True(t, status.Successful)
+	assert.Equal(t, 1, status.SuccessStreak)
+	assert.Equal(t, 0, status.FailureStreak)
+
+	service.refreshHealthStatuses()
+	assert.True(t, service.getContentTypeHealthStatus("annotations").Reachable)
+	assert.True(t, healthService.gtgCheck().GoodToGo)
+}
+
+func TestEventReaderIsReachable_CircuitBreaker(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	source := &fakeSource{errs: map[string]error{"annotations": transportErr}}
+	cb := newCircuitBreaker(source, 1, time.Minute)
+	service := &healthcheckerService{source: cb, breaker: cb, contentTypes: []contentTypeConfig{annotationsConfig}, healthStatuses: map[string]healthStatus{}}
+	healthService := newHealthService(&healthConfig{}, service)
+
+	service.refreshHealthStatuses()
+	_, err := healthService.eventReaderIsReachable()
+	assert.Contains(t, err.Error(), "Consecutive checks: annotations 1 failed (unreachable after 1 failed, reachable again after 1 successful). Circuit breaker is open since ")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// recordedResponse is a call to the splunk-event-reader, as written to the recording file, one JSON object per line.
+// Error holds the transport error when there is no status, and the error reading the body otherwise.
+type recordedResponse struct {
+	Time   time.Time `json:"time"`
+	URL    string    `json:"url"`
+	Status int       `json:"status,omitempty"`
+	Body   string    `json:"body,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// recordingTransport records every call going through it, without changing what the caller gets.
+type recordingTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+	now  func() time.Time
+	sync.Mutex
+}
+
+func newRecordingTransport(next http.RoundTripper, out io.Writer) *recordingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordingTransport{next: next, out: out, now: time.Now}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	rec := recordedResponse{Time: t.now(), URL: req.URL.String()}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		rec.Error = err.Error()
+		t.write(rec)
+		return nil, err
+	}
+
+	b, readErr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	rec.Status = resp.StatusCode
+	rec.Body = string(b)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if readErr != nil {
+		rec.Error = readErr.Error()
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(b), failingReader{readErr}))
+	}
+
+	t.write(rec)
+	return resp, nil
+}
+
+// write never fails the call, a response that could not be recorded is only missing from the recording.
+func (t *recordingTransport) write(rec recordedResponse) {
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to record the response of %s", rec.URL)
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if _, err := t.out.Write(append(line, '\n')); err != nil {
+		logger.WithError(err).Warnf("Failed to record the response of %s", rec.URL)
+	}
+}
+
+// failingReader replays an error that happened while reading a body.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// rotatingFile appends to a file, which is moved to <path>.1 once it would grow over maxSize.
+// The older files are shifted up to <path>.<maxBackups>, older ones are removed.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	sync.Mutex
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, file: file, size: info.Size()}, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+
+	f.Lock()
+	defer f.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backupPath(f.path, i), backupPath(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, backupPath(f.path, 1)); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+
+	f.Lock()
+	defer f.Unlock()
+
+	return f.file.Close()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func readRecordings(t *testing.T, out *bytes.Buffer) []recordedResponse {
+
+	var recs []recordedResponse
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var rec recordedResponse
+		assert.NoError(t, json.Unmarshal([]byte(line), &rec))
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestRecordingTransport_RecordsResponses(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("try later"))
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	recorder := newRecordingTransport(nil, out)
+	recorder.now = func() time.Time { return time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC) }
+	client := &http.Client{Transport: recorder}
+
+	resp, err := client.Get(server.URL + "/annotations/transactions?earliestTime=-15m&latestTime=-5m")
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// the caller still gets the whole response
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "try later", string(body))
+
+	assert.Equal(t, []recordedResponse{{
+		Time:   time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC),
+		URL:    server.URL + "/annotations/transactions?earliestTime=-15m&latestTime=-5m",
+		Status: http.StatusServiceUnavailable,
+		Body:   "try later",
+	}}, readRecordings(t, out))
+}
+
+func TestRecordingTransport_RecordsErrors(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	recorder := newRecordingTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}), out)
+
+	_, err := (&http.Client{Transport: recorder}).Get("http://localhost:8080/annotations/transactions")
+	assert.Error(t, err)
+
+	recs := readRecordings(t, out)
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, "connection refused", recs[0].Error)
+		assert.Equal(t, 0, recs[0].Status)
+	}
+
+	out.Reset()
+	recorder = newRecordingTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(failingReader{errors.New("unexpected EOF")})}, nil
+	}), out)
+
+	resp, err := (&http.Client{Transport: recorder}).Get("http://localhost:8080/annotations/transactions")
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.EqualError(t, err, "unexpected EOF")
+
+	recs = readRecordings(t, out)
+	if assert.Len(t, recs, 1) {
+		assert.Equal(t, "unexpected EOF", recs[0].Error)
+		assert.Equal(t, http.StatusOK, recs[0].Status)
+	}
+}
+
+func TestRotatingFile_Rotates(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "calls.jsonl")
+
+	file, err := openRotatingFile(path, 10, 2)
+	assert.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, file.Close())
+
+	for path, expected := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		content, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content), path)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	// an existing file is appended to
+	file, err = openRotatingFile(path, 100, 2)
+	assert.NoError(t, err)
+	file.Write([]byte("fifth\n"))
+	assert.NoError(t, file.Close())
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "fourth\nfifth\n", string(content))
+}
+
+func TestRotatingFile_WithoutBackups(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "calls.jsonl")
+
+	file, err := openRotatingFile(path, 10, 0)
+	assert.NoError(t, err)
+	file.Write([]byte("first\n"))
+	file.Write([]byte("second\n"))
+	assert.NoError(t, file.Close())
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "second\n", string(content))
+	_, err = os.Stat(path + ".1")
+	assert.True(t, os.IsNotExist(err))
+}
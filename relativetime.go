@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// relativeTimePattern matches the subset of Splunk relative time modifiers supported by the healthchecker:
+// an optional signed offset (e.g. -15m, -2h, -1d) followed by an optional snap-to unit (e.g. @m, @h, @d).
+var relativeTimePattern = regexp.MustCompile(`^(?:([+-])(\d*)([a-z]+))?(?:@([a-z]+))?$`)
+
+var timeUnits = map[string]string{
+	"s": "s", "sec": "s", "secs": "s", "second": "s", "seconds": "s",
+	"m": "m", "min": "m", "mins": "m", "minute": "m", "minutes": "m",
+	"h": "h", "hr": "h", "hrs": "h", "hour": "h", "hours": "h",
+	"d": "d", "day": "d", "days": "d",
+}
+
+var unitDurations = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// relativeTime is a parsed Splunk-style relative time, like "-15m" or "-1h@h".
+// It can also hold an absolute time, which resolves to itself: only the ad-hoc queries and the reports use those.
+type relativeTime struct {
+	raw      string
+	amount   int
+	unit     string
+	snap     string
+	absolute time.Time
+}
+
+func parseRelativeTime(value string) (relativeTime, error) {
+
+	if value == "now" || value == "0" {
+		return relativeTime{raw: value}, nil
+	}
+
+	groups := relativeTimePattern.FindStringSubmatch(value)
+	if value == "" || groups == nil {
+		return relativeTime{}, fmt.Errorf("%q is not a valid relative time, expected something like -15m or -1h@h", value)
+	}
+
+	rt := relativeTime{raw: value}
+	if groups[3] != "" {
+		unit, ok := timeUnits[groups[3]]
+		if !ok {
+			return relativeTime{}, fmt.Errorf("%q has an unsupported time unit %q, use s, m, h or d", value, groups[3])
+		}
+		rt.unit = unit
+		rt.amount = 1
+		if groups[2] != "" {
+			amount, err := strconv.Atoi(groups[2])
+			if err != nil {
+				return relativeTime{}, fmt.Errorf("%q has an invalid amount: %v", value, err)
+			}
+			rt.amount = amount
+		}
+		if groups[1] == "-" {
+			rt.amount = -rt.amount
+		}
+	}
+
+	if groups[4] != "" {
+		snap, ok := timeUnits[groups[4]]
+		if !ok {
+			return relativeTime{}, fmt.Errorf("%q has an unsupported snap-to unit %q, use s, m, h or d", value, groups[4])
+		}
+		rt.snap = snap
+	}
+
+	return rt, nil
+}
+
+// parseQueryTime parses a bound of the window of an ad-hoc query, which can also be an absolute time given as an RFC3339 timestamp.
+// The configured windows are evaluated anew at every check, so they stay relative.
+func parseQueryTime(value string) (relativeTime, error) {
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return relativeTime{raw: value, absolute: t}, nil
+	}
+
+	rt, err := parseRelativeTime(value)
+	if err != nil && !relativeTimePattern.MatchString(value) {
+		return relativeTime{}, fmt.Errorf("%q is not a valid relative time, expected something like -15m, -1h@h or an RFC3339 timestamp", value)
+	}
+	return rt, err
+}
+
+// isSet tells whether the value was given at all, as the zero value is indistinguishable from "now" otherwise.
+func (rt relativeTime) isSet() bool {
+	return rt.raw != ""
+}
+
+func (rt relativeTime) offset() time.Duration {
+	return time.Duration(rt.amount) * unitDurations[rt.unit]
+}
+
+func absoluteTime(t time.Time) relativeTime {
+	return relativeTime{raw: t.Format(time.RFC3339), absolute: t}
+}
+
+func (rt relativeTime) isAbsolute() bool {
+	return !rt.absolute.IsZero()
+}
+
+// resolve returns the absolute time the relative time refers to, when evaluated at the reference time.
+func (rt relativeTime) resolve(reference time.Time) time.Time {
+
+	if rt.isAbsolute() {
+		return rt.absolute
+	}
+
+	t := reference.Add(rt.offset())
+
+	y, mo, d := t.Date()
+	h, mi, s := t.Clock()
+	switch rt.snap {
+	case "s":
+		t = time.Date(y, mo, d, h, mi, s, 0, t.Location())
+	case "m":
+		t = time.Date(y, mo, d, h, mi, 0, 0, t.Location())
+	case "h":
+		t = time.Date(y, mo, d, h, 0, 0, 0, t.Location())
+	case "d":
+		t = time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+	}
+
+	return t
+}
+
+// String returns the normalised form of the relative time.
+func (rt relativeTime) String() string {
+
+	if rt.isAbsolute() {
+		return rt.absolute.Format(time.RFC3339)
+	}
+
+	if rt.unit == "" && rt.snap == "" {
+		return "now"
+	}
+
+	s := ""
+	if rt.unit != "" {
+		s = fmt.Sprintf("%+d%s", rt.amount, rt.unit)
+	}
+	if rt.snap != "" {
+		s += "@" + rt.snap
+	}
+	return s
+}
+
+// splunkValue returns the value sent to the splunk-event-reader: the normalised relative time,
+// or the Unix time for an absolute time, as Splunk accepts both as time modifiers.
+func (rt relativeTime) splunkValue() string {
+	if rt.isAbsolute() {
+		return strconv.FormatInt(rt.absolute.Unix(), 10)
+	}
+	return rt.String()
+}
+
+func (rt relativeTime) MarshalText() ([]byte, error) {
+	return []byte(rt.String()), nil
+}
+
+func (rt *relativeTime) UnmarshalText(text []byte) error {
+	parsed, err := parseRelativeTime(string(text))
+	if err != nil {
+		return err
+	}
+	*rt = parsed
+	return nil
+}
+
+// validateWindow checks that the window is not empty and does not reach into the future.
+func validateWindow(earliest relativeTime, latest relativeTime, now time.Time) error {
+
+	from := earliest.resolve(now)
+	to := latest.resolve(now)
+
+	if !from.Before(to) {
+		return fmt.Errorf("earliest time %s should be before latest time %s", earliest, latest)
+	}
+	if to.After(now) {
+		return fmt.Errorf("latest time %s should not be in the future", latest)
+	}
+	return nil
+}
+
+// validateRecurringWindow checks that a window evaluated anew at every check is never empty and never reaches into the future.
+// Whether a snapped window holds depends on the time it is resolved at, e.g. @h to -5m is empty during the first 5 minutes of every hour,
+// so it is checked at every second of a full snap period, and just before every second.
+func validateRecurringWindow(earliest relativeTime, latest relativeTime) error {
+
+	reference := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	period := unitDurations[earliest.snap]
+	if unitDurations[latest.snap] > period {
+		period = unitDurations[latest.snap]
+	}
+	if period == 0 {
+		return validateWindow(earliest, latest, reference)
+	}
+
+	for at := reference; at.Before(reference.Add(period)); at = at.Add(time.Second) {
+		for _, now := range []time.Time{at.Add(-time.Nanosecond), at} {
+			if err := validateWindow(earliest, latest, now); err != nil {
+				return fmt.Errorf("%v when checked at %s", err, now.Format("15:04:05.999999999"))
+			}
+		}
+	}
+	return nil
+}
+
+func mustParseRelativeTime(value string) relativeTime {
+	rt, err := parseRelativeTime(value)
+	if err != nil {
+		panic(err)
+	}
+	return rt
+}
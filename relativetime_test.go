@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseRelativeTime(t *testing.T) {
+
+	reference := time.Date(2017, 12, 19, 16, 43, 6, 351754912, time.UTC)
+
+	var tests = []struct {
+		value      string
+		normalised string
+		resolved   time.Time
+	}{
+		{"-15m", "-15m", time.Date(2017, 12, 19, 16, 28, 6, 351754912, time.UTC)},
+		{"-300s", "-300s", time.Date(2017, 12, 19, 16, 38, 6, 351754912, time.UTC)},
+		{"-2hours", "-2h", time.Date(2017, 12, 19, 14, 43, 6, 351754912, time.UTC)},
+		{"-1d", "-1d", time.Date(2017, 12, 18, 16, 43, 6, 351754912, time.UTC)},
+		{"-min", "-1m", time.Date(2017, 12, 19, 16, 42, 6, 351754912, time.UTC)},
+		{"-1h@h", "-1h@h", time.Date(2017, 12, 19, 15, 0, 0, 0, time.UTC)},
+		{"-5m@m", "-5m@m", time.Date(2017, 12, 19, 16, 38, 0, 0, time.UTC)},
+		{"@d", "@d", time.Date(2017, 12, 19, 0, 0, 0, 0, time.UTC)},
+		{"@s", "@s", time.Date(2017, 12, 19, 16, 43, 6, 0, time.UTC)},
+		{"now", "now", reference},
+		{"0", "now", reference},
+	}
+
+	for _, test := range tests {
+		rt, err := parseRelativeTime(test.value)
+		if assert.NoError(t, err, test.value) {
+			assert.Equal(t, test.normalised, rt.String(), test.value)
+			assert.Equal(t, test.resolved, rt.resolve(reference), test.value)
+			assert.True(t, rt.isSet(), test.value)
+		}
+	}
+}
+
+func TestParseRelativeTime_Invalid(t *testing.T) {
+
+	for _, value := range []string{"", "15m", "-15", "-15w", "-15m@w", "-15m@", "yesterday", "-1.5h", "2017-12-19 09:00:00", "2017-12-19T09:00:00Z"} {
+		_, err := parseRelativeTime(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestRelativeTime_SplunkValue(t *testing.T) {
+	assert.Equal(t, "-60m@h", mustParseRelativeTime("-60minutes@hour").splunkValue())
+	assert.Equal(t, "now", mustParseRelativeTime("0").splunkValue())
+	assert.Equal(t, "1513674000", mustParseQueryTime("2017-12-19T09:00:00Z").splunkValue())
+	assert.Equal(t, "1513674000", mustParseQueryTime("2017-12-19T10:00:00+01:00").splunkValue())
+}
+
+func TestParseQueryTime(t *testing.T) {
+
+	reference := time.Date(2017, 12, 19, 16, 43, 6, 351754912, time.UTC)
+
+	rt, err := parseQueryTime("2017-12-19T09:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "2017-12-19T09:00:00Z", rt.String())
+	assert.Equal(t, time.Date(2017, 12, 19, 9, 0, 0, 0, time.UTC), rt.resolve(reference))
+
+	for _, value := range []string{"-1h@h", "now"} {
+		rt, err = parseQueryTime(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, mustParseRelativeTime(value), rt, value)
+	}
+
+	_, err = parseQueryTime("yesterday")
+	assert.EqualError(t, err, `"yesterday" is not a valid relative time, expected something like -15m, -1h@h or an RFC3339 timestamp`)
+}
+
+func mustParseQueryTime(value string) relativeTime {
+	rt, err := parseQueryTime(value)
+	if err != nil {
+		panic(err)
+	}
+	return rt
+}
+
+func TestRelativeTime_UnmarshalText(t *testing.T) {
+
+	var rt relativeTime
+	assert.NoError(t, rt.UnmarshalText([]byte("-10minutes")))
+	assert.Equal(t, 10*time.Minute, -rt.offset())
+
+	text, err := rt.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "-10m", string(text))
+
+	assert.Error(t, rt.UnmarshalText([]byte("-10 minutes")))
+}
+
+func TestValidateWindow(t *testing.T) {
+
+	now := time.Now()
+
+	assert.NoError(t, validateWindow(mustParseRelativeTime("-15m"), mustParseRelativeTime("-5m"), now))
+	assert.NoError(t, validateWindow(mustParseRelativeTime("-1d@d"), mustParseRelativeTime("@d"), now))
+	assert.EqualError(t, validateWindow(mustParseRelativeTime("-5m"), mustParseRelativeTime("-5m"), now), "earliest time -5m should be before latest time -5m")
+	assert.EqualError(t, validateWindow(mustParseRelativeTime("-5m"), mustParseRelativeTime("+1h"), now), "latest time +1h should not be in the future")
+}
+
+func TestValidateRecurringWindow(t *testing.T) {
+
+	assert.NoError(t, validateRecurringWindow(mustParseRelativeTime("-15m"), mustParseRelativeTime("-5m")))
+	assert.NoError(t, validateRecurringWindow(mustParseRelativeTime("-1h@h"), mustParseRelativeTime("-5m")))
+	assert.NoError(t, validateRecurringWindow(mustParseRelativeTime("-1d@d"), mustParseRelativeTime("@d")))
+	assert.EqualError(t, validateRecurringWindow(mustParseRelativeTime("-5m"), mustParseRelativeTime("-5m")), "earliest time -5m should be before latest time -5m")
+	assert.EqualError(t, validateRecurringWindow(mustParseRelativeTime("@h"), mustParseRelativeTime("-5m")), "earliest time @h should be before latest time -5m when checked at 00:00:00")
+	assert.EqualError(t, validateRecurringWindow(mustParseRelativeTime("-5m"), mustParseRelativeTime("+1m@h")), "latest time +1m@h should not be in the future when checked at 23:59:59.999999999")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replayedCheck is the outcome of a replayed check, as printed by the replay subcommand.
+type replayedCheck struct {
+	CheckTime string                  `json:"check_time"`
+	Health    map[string]healthStatus `json:"health"`
+}
+
+// loadRecordings reads a recording file along with its rotated backups, oldest first.
+func loadRecordings(path string, maxBackups int) ([]recordedResponse, error) {
+
+	var paths []string
+	for i := maxBackups; i >= 1; i-- {
+		if _, err := os.Stat(backupPath(path, i)); err == nil {
+			paths = append(paths, backupPath(path, i))
+		}
+	}
+	paths = append(paths, path)
+
+	var recs []recordedResponse
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var rec recordedResponse
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				return nil, fmt.Errorf("%s:%d is not a recorded response: %v", p, line, err)
+			}
+			recs = append(recs, rec)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+// replayTransport answers the calls with the recorded responses, in the order they were recorded for each content type.
+// Only the responses recorded before the until time are served, so a check does not take the responses of the next one.
+type replayTransport struct {
+	pending map[string][]recordedResponse
+	until   time.Time
+	served  int
+	sync.Mutex
+}
+
+func newReplayTransport(recs []recordedResponse) *replayTransport {
+
+	pending := map[string][]recordedResponse{}
+	for _, rec := range recs {
+		ct := recordedContentType(rec.URL)
+		pending[ct] = append(pending[ct], rec)
+	}
+	return &replayTransport{pending: pending}
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	ct := recordedContentType(req.URL.String())
+
+	t.Lock()
+	recs := t.pending[ct]
+	if len(recs) == 0 || (!t.until.IsZero() && !recs[0].Time.Before(t.until)) {
+		t.Unlock()
+		return nil, fmt.Errorf("no recorded response left for %s", ct)
+	}
+	rec := recs[0]
+	t.pending[ct] = recs[1:]
+	t.served++
+	t.Unlock()
+
+	if rec.Status == 0 {
+		return nil, errors.New(rec.Error)
+	}
+
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode: rec.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(rec.Body)),
+		Request:    req,
+	}
+	if rec.Error != "" {
+		resp.Body = ioutil.NopCloser(io.MultiReader(strings.NewReader(rec.Body), failingReader{errors.New(rec.Error)}))
+	}
+	return resp, nil
+}
+
+// next returns the time of the earliest response left to replay.
+func (t *replayTransport) next() (time.Time, bool) {
+
+	t.Lock()
+	defer t.Unlock()
+
+	var earliest time.Time
+	found := false
+	for _, recs := range t.pending {
+		if len(recs) > 0 && (!found || recs[0].Time.Before(earliest)) {
+			earliest = recs[0].Time
+			found = true
+		}
+	}
+	return earliest, found
+}
+
+func (t *replayTransport) window(until time.Time) int {
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.until = until
+	return t.served
+}
+
+func (t *replayTransport) servedCount() int {
+
+	t.Lock()
+	defer t.Unlock()
+
+	return t.served
+}
+
+// replayChecks runs the checks of the service again over the recorded responses, with a clock simulated from the recording times:
+// every check happens at the time of the earliest response left. The checks made while the circuit breaker was open
+// did not call the event reader, so they are simulated every poll interval until the next recorded response.
+func replayChecks(s *healthcheckerService, t *replayTransport, pollInterval time.Duration, emit func(replayedCheck) error) error {
+
+	var clock time.Time
+	s.now = func() time.Time { return clock }
+	if s.breaker != nil {
+		s.breaker.now = s.now
+	}
+	// the retries of the recording already waited, and the budget of the check was spent back then
+	s.retries.jitter = func(time.Duration) time.Duration { return 0 }
+	s.checkBudget = 0
+
+	var last time.Time
+	for {
+		next, found := t.next()
+		if !found {
+			return nil
+		}
+
+		clock = next
+		simulated := false
+		if s.breaker != nil && !last.IsZero() && last.Add(pollInterval).Before(next) && s.breaker.suspends(last.Add(pollInterval)) {
+			clock = last.Add(pollInterval)
+			simulated = true
+		}
+
+		served := t.window(clock.Add(pollInterval))
+		statuses := s.determineHealthStatuses()
+		if !simulated && t.servedCount() == served {
+			return fmt.Errorf("the recording does not match the configuration: the check at %s did not use any recorded response", clock.Format(timestampFormat))
+		}
+
+		s.Lock()
+		s.healthStatuses = statuses
+		s.Unlock()
+		last = clock
+
+		if err := emit(replayedCheck{CheckTime: clock.Format(timestampFormat), Health: statuses}); err != nil {
+			return err
+		}
+	}
+}
+
+// recordedContentType extracts the content type from the URL of a call, e.g. http://host/__splunk-event-reader/annotations/transactions?...
+func recordedContentType(rawURL string) string {
+
+	path := rawURL
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), "/transactions")
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Financial-Times/annotations-publish-healthchecker/fakereader"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var listsConfig = contentTypeConfig{
+	ContentType:      "lists",
+	EarliestTime:     mustParseRelativeTime(earliestTime),
+	LatestTime:       mustParseRelativeTime(latestTime),
+	SLAWindow:        2,
+	FailureThreshold: 2,
+}
+
+func newReplayTestService(address string, transport http.RoundTripper) *healthcheckerService {
+
+	source := newEventReaderSource(address, &http.Client{Transport: transport})
+	breaker := newCircuitBreaker(source, 1, 90*time.Second)
+	return &healthcheckerService{
+		source:           breaker,
+		breaker:          breaker,
+		retries:          retryPolicy{retries: 1, jitter: noJitter},
+		unreachableAfter: 1,
+		reachableAfter:   1,
+		contentTypes:     []contentTypeConfig{annotationsConfig, listsConfig},
+		healthStatuses:   map[string]healthStatus{},
+	}
+}
+
+func TestReplayChecks_ReproducesTheRecordedChecks(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+
+	malformed := "[{"
+	old := []fakereader.Transaction{{TransactionID: "tid_1", UUID: "uuid_1", Age: fakereader.Duration(30 * time.Minute)}}
+	server := fakereader.NewServer(fakereader.Scenario{ContentTypes: map[string]fakereader.Script{
+		"annotations": {Steps: []fakereader.Step{
+			{Transactions: old},
+			{Repeat: 2, Status: http.StatusServiceUnavailable},
+			{Body: &malformed},
+			{Transactions: old},
+		}},
+	}})
+	defer server.Close()
+
+	clock := time.Now()
+	now := func() time.Time { return clock }
+
+	out := &bytes.Buffer{}
+	recorder := newRecordingTransport(nil, out)
+	recorder.now = now
+	live := newReplayTestService(server.URL, recorder)
+	live.now = now
+	live.breaker.now = now
+
+	// the second check opens the circuit breaker, so the third one does not call the event reader
+	var expected []string
+	for i := 0; i < 5; i++ {
+		live.refreshHealthStatuses()
+		msg, _ := json.Marshal(replayedCheck{CheckTime: clock.Format(timestampFormat), Health: live.healthStatuses})
+		expected = append(expected, string(msg))
+		clock = clock.Add(time.Minute)
+	}
+	assert.Equal(t, breakerClosed, live.breaker.status().State)
+
+	recs := readRecordings(t, out)
+	assert.Len(t, recs, 8)
+
+	replay := newReplayTransport(recs)
+	replayed := newReplayTestService(server.URL, replay)
+	var actual []string
+	err := replayChecks(replayed, replay, time.Minute, func(check replayedCheck) error {
+		msg, _ := json.Marshal(check)
+		actual = append(actual, string(msg))
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestReplayChecks_MismatchingConfiguration(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+
+	replay := newReplayTransport([]recordedResponse{{Time: time.Now(), URL: "http://localhost:8080/pages/transactions", Status: http.StatusOK, Body: "[]"}})
+	s := newReplayTestService("http://localhost:8080", replay)
+
+	checks := 0
+	err := replayChecks(s, replay, time.Minute, func(check replayedCheck) error {
+		checks++
+		return nil
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "did not use any recorded response")
+	assert.Equal(t, 0, checks)
+}
+
+func TestReplayTransport_KeepsTheResponsesOfTheNextCheck(t *testing.T) {
+
+	at := time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC)
+	replay := newReplayTransport([]recordedResponse{
+		{Time: at, URL: "http://localhost:8080/annotations/transactions", Status: http.StatusServiceUnavailable},
+		{Time: at.Add(time.Minute), URL: "http://localhost:8080/annotations/transactions", Status: http.StatusOK, Body: "[]"},
+	})
+	client := &http.Client{Transport: replay}
+
+	replay.window(at.Add(time.Minute))
+	resp, err := client.Get("http://localhost:8080/annotations/transactions")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	_, err = client.Get("http://localhost:8080/annotations/transactions")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no recorded response left for annotations")
+
+	replay.window(at.Add(2 * time.Minute))
+	resp, err = client.Get("http://localhost:8080/annotations/transactions")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "[]", string(body))
+
+	_, found := replay.next()
+	assert.False(t, found)
+}
+
+func TestLoadRecordings(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "calls.jsonl")
+
+	ioutil.WriteFile(path+".2", []byte(`{"time":"2018-01-15T14:00:00Z","url":"http://localhost/annotations/transactions","status":200,"body":"[]"}`+"\n"), 0644)
+	ioutil.WriteFile(path+".1", []byte(`{"time":"2018-01-15T14:01:00Z","url":"http://localhost/annotations/transactions","error":"connection refused"}`+"\n\n"), 0644)
+	ioutil.WriteFile(path, []byte(`{"time":"2018-01-15T14:02:00Z","url":"http://localhost/annotations/transactions","status":503}`+"\n"), 0644)
+
+	recs, err := loadRecordings(path, 5)
+	assert.NoError(t, err)
+	if assert.Len(t, recs, 3) {
+		assert.Equal(t, "[]", recs[0].Body)
+		assert.Equal(t, "connection refused", recs[1].Error)
+		assert.Equal(t, 503, recs[2].Status)
+	}
+
+	ioutil.WriteFile(path, []byte("not json\n"), 0644)
+	_, err = loadRecordings(path, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "calls.jsonl:1 is not a recorded response")
+}
+
+func TestRecordedContentType(t *testing.T) {
+	assert.Equal(t, "annotations", recordedContentType("http://localhost:8080/__splunk-event-reader/annotations/transactions?earliestTime=-15m&latestTime=-5m"))
+	assert.Equal(t, "lists", recordedContentType("http://localhost:8080/lists/transactions"))
+}
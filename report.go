@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reportFormatMarkdown = "markdown"
+	reportFormatCSV      = "csv"
+	reportFormatJSON     = "json"
+)
+
+// reportInterval is the result of the check of a content type, as it would have run at the given time.
+type reportInterval struct {
+	Time               string `json:"time"`
+	ContentType        string `json:"content_type"`
+	EarliestTime       string `json:"earliest_time"`
+	LatestTime         string `json:"latest_time"`
+	FailedTransactions int    `json:"failed_transactions"`
+	Alert              bool   `json:"alert"`
+	Tier               string `json:"tier,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+// reportUUID is a content that failed to publish, however many times the checks found it.
+type reportUUID struct {
+	ContentType    string   `json:"content_type"`
+	UUID           string   `json:"uuid"`
+	TransactionIDs []string `json:"transaction_ids"`
+	FirstSeen      string   `json:"first_seen"`
+	LastSeen       string   `json:"last_seen"`
+	Checks         int      `json:"checks"`
+}
+
+type reportSummary struct {
+	ContentType    string `json:"content_type"`
+	Checks         int    `json:"checks"`
+	AlertingChecks int    `json:"alerting_checks"`
+	FailedChecks   int    `json:"failed_checks"`
+	FailedUUIDs    int    `json:"failed_uuids"`
+}
+
+type publishReport struct {
+	Start       string           `json:"start"`
+	End         string           `json:"end"`
+	Step        string           `json:"step"`
+	Summary     []reportSummary  `json:"summary"`
+	Intervals   []reportInterval `json:"intervals"`
+	FailedUUIDs []reportUUID     `json:"failed_uuids"`
+}
+
+// buildReport replays the checks of every content type at each step from start to end (both inclusive).
+// Each check queries the window the live service would have queried at that time, and applies the same SLA window and failure thresholds.
+func buildReport(ctx context.Context, source TransactionSource, retries retryPolicy, contentTypes []contentTypeConfig, start time.Time, end time.Time, step time.Duration) publishReport {
+
+	report := publishReport{
+		Start:       start.Format(time.RFC3339),
+		End:         end.Format(time.RFC3339),
+		Step:        step.String(),
+		Intervals:   []reportInterval{},
+		FailedUUIDs: []reportUUID{},
+	}
+
+	uuids := map[string]*reportUUID{}
+	for _, ct := range contentTypes {
+		summary := reportSummary{ContentType: ct.ContentType}
+
+		for at := start; !at.After(end); at = at.Add(step) {
+			interval, txs := replayCheck(ctx, source, retries, ct, at)
+			report.Intervals = append(report.Intervals, interval)
+
+			summary.Checks++
+			if interval.Alert {
+				summary.AlertingChecks++
+			}
+			if interval.Error != "" {
+				summary.FailedChecks++
+			}
+
+			for _, tx := range txs {
+				key := tx.UUID
+				if key == "" {
+					key = tx.TransactionID
+				}
+				u, found := uuids[ct.ContentType+"/"+key]
+				if !found {
+					u = &reportUUID{ContentType: ct.ContentType, UUID: tx.UUID, FirstSeen: interval.Time}
+					uuids[ct.ContentType+"/"+key] = u
+					summary.FailedUUIDs++
+				}
+				if u.LastSeen != interval.Time {
+					u.Checks++
+				}
+				u.LastSeen = interval.Time
+				if !containsString(u.TransactionIDs, tx.TransactionID) {
+					u.TransactionIDs = append(u.TransactionIDs, tx.TransactionID)
+				}
+			}
+		}
+
+		report.Summary = append(report.Summary, summary)
+	}
+
+	for _, u := range uuids {
+		report.FailedUUIDs = append(report.FailedUUIDs, *u)
+	}
+	sort.Slice(report.FailedUUIDs, func(i, j int) bool {
+		a, b := report.FailedUUIDs[i], report.FailedUUIDs[j]
+		if a.ContentType != b.ContentType {
+			return a.ContentType < b.ContentType
+		}
+		if a.FirstSeen != b.FirstSeen {
+			return a.FirstSeen < b.FirstSeen
+		}
+		return a.UUID < b.UUID
+	})
+
+	return report
+}
+
+// parseReportPeriod parses the start and end of a report. The end defaults to now, and can't be in the future.
+func parseReportPeriod(start string, end string, now time.Time) (time.Time, time.Time, error) {
+
+	if start == "" {
+		return time.Time{}, time.Time{}, errors.New("the start is required")
+	}
+	from, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("the start should be an RFC3339 timestamp, got %q", start)
+	}
+
+	to := now
+	if end != "" {
+		to, err = time.Parse(time.RFC3339, end)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("the end should be an RFC3339 timestamp, got %q", end)
+		}
+	}
+
+	if to.After(now) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the end %s should not be in the future", end)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the start %s should be before the end %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
+
+func replayCheck(ctx context.Context, source TransactionSource, retries retryPolicy, ct contentTypeConfig, at time.Time) (reportInterval, transactions) {
+
+	// the window the live service would have queried at that time
+	ct.EarliestTime = absoluteTime(ct.EarliestTime.resolve(at))
+	ct.LatestTime = absoluteTime(ct.LatestTime.resolve(at))
+
+	interval := reportInterval{
+		Time:         at.Format(time.RFC3339),
+		ContentType:  ct.ContentType,
+		EarliestTime: ct.EarliestTime.String(),
+		LatestTime:   ct.LatestTime.String(),
+	}
+
+	txs, _, err := fetchFailedTransactions(ctx, source, retries, ct, at)
+	if err != nil {
+		interval.Error = err.Error()
+		return interval, nil
+	}
+
+	interval.FailedTransactions = len(txs)
+	if reached := ct.reachedTier(len(txs)); reached >= 0 {
+		interval.Alert = true
+		interval.Tier = ct.failureTiers()[reached].Name
+	}
+	return interval, txs
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeReport(out io.Writer, report publishReport, format string) error {
+	switch format {
+	case reportFormatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case reportFormatCSV:
+		return writeReportCSV(out, report)
+	default:
+		return writeReportMarkdown(out, report)
+	}
+}
+
+func writeReportMarkdown(out io.Writer, report publishReport) error {
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Publish health report\n\nChecks from %s to %s, every %s.\n", report.Start, report.End, report.Step)
+
+	b.WriteString("\n## Summary\n\n| Content type | Checks | Alerting checks | Failed checks | Failed UUIDs |\n| --- | ---: | ---: | ---: | ---: |\n")
+	for _, s := range report.Summary {
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %d |\n", s.ContentType, s.Checks, s.AlertingChecks, s.FailedChecks, s.FailedUUIDs)
+	}
+
+	b.WriteString("\n## Checks\n\n| Time | Content type | Window | Failed transactions | Alert | Details |\n| --- | --- | --- | ---: | --- | --- |\n")
+	for _, i := range report.Intervals {
+		alert := "no"
+		if i.Alert {
+			alert = "yes"
+		}
+		details := i.Error
+		if i.Tier != "" {
+			details = i.Tier + " tier"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s - %s | %d | %s | %s |\n", i.Time, i.ContentType, i.EarliestTime, i.LatestTime, i.FailedTransactions, alert, escapeMarkdown(details))
+	}
+
+	b.WriteString("\n## Failed UUIDs\n\n| Content type | UUID | Transaction IDs | First seen | Last seen | Checks |\n| --- | --- | --- | --- | --- | ---: |\n")
+	for _, u := range report.FailedUUIDs {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %d |\n", u.ContentType, u.UUID, strings.Join(u.TransactionIDs, ", "), u.FirstSeen, u.LastSeen, u.Checks)
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func escapeMarkdown(value string) string {
+	return strings.Replace(value, "|", `\|`, -1)
+}
+
+// writeReportCSV writes the checks, then the failed UUIDs, as two CSV tables separated by an empty line.
+func writeReportCSV(out io.Writer, report publishReport) error {
+
+	w := csv.NewWriter(out)
+
+	w.Write([]string{"time", "content_type", "earliest_time", "latest_time", "failed_transactions", "alert", "tier", "error"})
+	for _, i := range report.Intervals {
+		w.Write([]string{i.Time, i.ContentType, i.EarliestTime, i.LatestTime, strconv.Itoa(i.FailedTransactions), strconv.FormatBool(i.Alert), i.Tier, i.Error})
+	}
+	w.Flush()
+
+	if _, err := io.WriteString(out, "\n"); err != nil {
+		return err
+	}
+
+	w.Write([]string{"content_type", "uuid", "transaction_ids", "first_seen", "last_seen", "checks"})
+	for _, u := range report.FailedUUIDs {
+		w.Write([]string{u.ContentType, u.UUID, strings.Join(u.TransactionIDs, " "), u.FirstSeen, u.LastSeen, strconv.Itoa(u.Checks)})
+	}
+	w.Flush()
+
+	return w.Error()
+}
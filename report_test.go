@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// windowSource returns its transactions which started inside the queried window, like the event reader does for the open transactions.
+type windowSource struct {
+	txs transactions
+}
+
+func (s *windowSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+
+	now := time.Now()
+	from, to := earliestTime.resolve(now), latestTime.resolve(now)
+
+	res := transactions{}
+	for _, tx := range s.txs {
+		t, _ := time.Parse(timestampFormat, tx.LastModified)
+		if !t.Before(from) && !t.After(to) {
+			res = append(res, tx)
+		}
+	}
+	return res, nil
+}
+
+var reportTxs = transactions{
+	{TransactionID: "tid1", UUID: "uuid1", LastModified: "2018-01-15T09:50:00.000Z"},
+	{TransactionID: "tid2", UUID: "uuid2", LastModified: "2018-01-15T09:52:00.000Z"},
+	{TransactionID: "tid3", UUID: "uuid1", LastModified: "2018-01-15T09:57:00.000Z"},
+	{TransactionID: "tid4", UUID: "uuid3", LastModified: "2018-01-15T09:54:00.000Z"},
+}
+
+func TestBuildReport(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	start := time.Date(2018, 1, 15, 10, 0, 0, 0, time.UTC)
+	listsConfig := contentTypeConfig{ContentType: "lists", EarliestTime: annotationsConfig.EarliestTime, LatestTime: annotationsConfig.LatestTime, FailureThreshold: 1}
+	source := &contentTypeSource{sources: map[string]TransactionSource{
+		"annotations": &windowSource{txs: reportTxs},
+		"lists":       &fakeSource{errs: map[string]error{"lists": status503Err}},
+	}}
+
+	report := buildReport(context.Background(), source, retryPolicy{}, []contentTypeConfig{annotationsConfig, listsConfig}, start, start.Add(10*time.Minute), 5*time.Minute)
+
+	assert.Equal(t, "2018-01-15T10:00:00Z", report.Start)
+	assert.Equal(t, "2018-01-15T10:10:00Z", report.End)
+	assert.Equal(t, "5m0s", report.Step)
+	assert.Equal(t, []reportSummary{
+		{ContentType: "annotations", Checks: 3, AlertingChecks: 2, FailedUUIDs: 3},
+		{ContentType: "lists", Checks: 3, FailedChecks: 3},
+	}, report.Summary)
+
+	assert.Len(t, report.Intervals, 6)
+	assert.Equal(t, reportInterval{Time: "2018-01-15T10:00:00Z", ContentType: "annotations", EarliestTime: "2018-01-15T09:45:00Z", LatestTime: "2018-01-15T09:55:00Z", FailedTransactions: 2, Alert: true}, report.Intervals[0])
+	assert.Equal(t, reportInterval{Time: "2018-01-15T10:05:00Z", ContentType: "annotations", EarliestTime: "2018-01-15T09:50:00Z", LatestTime: "2018-01-15T10:00:00Z", FailedTransactions: 4, Alert: true}, report.Intervals[1])
+	assert.Equal(t, reportInterval{Time: "2018-01-15T10:10:00Z", ContentType: "annotations", EarliestTime: "2018-01-15T09:55:00Z", LatestTime: "2018-01-15T10:05:00Z", FailedTransactions: 1}, report.Intervals[2])
+	assert.Equal(t, "failed to retrieve transactions: unexpected status code 503", report.Intervals[3].Error)
+	assert.False(t, report.Intervals[3].Alert)
+
+	assert.Equal(t, []reportUUID{
+		{ContentType: "annotations", UUID: "uuid1", TransactionIDs: []string{"tid1", "tid3"}, FirstSeen: "2018-01-15T10:00:00Z", LastSeen: "2018-01-15T10:10:00Z", Checks: 3},
+		{ContentType: "annotations", UUID: "uuid2", TransactionIDs: []string{"tid2"}, FirstSeen: "2018-01-15T10:00:00Z", LastSeen: "2018-01-15T10:05:00Z", Checks: 2},
+		{ContentType: "annotations", UUID: "uuid3", TransactionIDs: []string{"tid4"}, FirstSeen: "2018-01-15T10:05:00Z", LastSeen: "2018-01-15T10:05:00Z", Checks: 1},
+	}, report.FailedUUIDs)
+}
+
+func TestReplayCheck_MatchesTheLiveCheck(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	now := time.Now().UTC()
+	source := &windowSource{}
+	for i := 0; i < 30; i++ {
+		source.txs = append(source.txs, transaction{TransactionID: "tid", LastModified: now.Add(-time.Duration(i) * time.Minute).Format(timestampFormat)})
+	}
+
+	live := determineHealth(context.Background(), source, retryPolicy{}, annotationsConfig, time.Now())
+	interval, txs := replayCheck(context.Background(), source, retryPolicy{}, annotationsConfig, live.checkedAt)
+
+	assert.Equal(t, len(live.OpenTransactions), interval.FailedTransactions)
+	assert.Equal(t, live.OpenTransactions, []transaction(txs))
+	assert.True(t, interval.Alert)
+}
+
+func TestParseReportPeriod(t *testing.T) {
+
+	now := time.Date(2018, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	from, to, err := parseReportPeriod("2018-01-01T00:00:00Z", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, now, to)
+
+	var tests = []struct {
+		start string
+		end   string
+		err   string
+	}{
+		{"", "", "the start is required"},
+		{"yesterday", "", `the start should be an RFC3339 timestamp, got "yesterday"`},
+		{"2018-01-01T00:00:00Z", "today", `the end should be an RFC3339 timestamp, got "today"`},
+		{"2018-01-01T00:00:00Z", "2018-02-01T00:00:00Z", "the end 2018-02-01T00:00:00Z should not be in the future"},
+		{"2018-01-02T00:00:00Z", "2018-01-01T00:00:00Z", "the start 2018-01-02T00:00:00Z should be before the end 2018-01-01T00:00:00Z"},
+	}
+
+	for _, test := range tests {
+		_, _, err := parseReportPeriod(test.start, test.end, now)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+var testReport = publishReport{
+	Start:   "2018-01-15T10:00:00Z",
+	End:     "2018-01-15T10:05:00Z",
+	Step:    "5m0s",
+	Summary: []reportSummary{{ContentType: "annotations", Checks: 2, AlertingChecks: 1, FailedChecks: 1, FailedUUIDs: 1}},
+	Intervals: []reportInterval{
+		{Time: "2018-01-15T10:00:00Z", ContentType: "annotations", EarliestTime: "2018-01-15T09:45:00Z", LatestTime: "2018-01-15T09:55:00Z", FailedTransactions: 2, Alert: true, Tier: "critical"},
+		{Time: "2018-01-15T10:05:00Z", ContentType: "annotations", EarliestTime: "2018-01-15T09:50:00Z", LatestTime: "2018-01-15T10:00:00Z", Error: "a|b"},
+	},
+	FailedUUIDs: []reportUUID{{ContentType: "annotations", UUID: "uuid1", TransactionIDs: []string{"tid1", "tid3"}, FirstSeen: "2018-01-15T10:00:00Z", LastSeen: "2018-01-15T10:00:00Z", Checks: 1}},
+}
+
+func TestWriteReport_Markdown(t *testing.T) {
+
+	var out bytes.Buffer
+	assert.NoError(t, writeReport(&out, testReport, reportFormatMarkdown))
+	assert.Equal(t, `# Publish health report
+
+Checks from 2018-01-15T10:00:00Z to 2018-01-15T10:05:00Z, every 5m0s.
+
+## Summary
+
+| Content type | Checks | Alerting checks | Failed checks | Failed UUIDs |
+| --- | ---: | ---: | ---: | ---: |
+| annotations | 2 | 1 | 1 | 1 |
+
+## Checks
+
+| Time | Content type | Window | Failed transactions | Alert | Details |
+| --- | --- | --- | ---: | --- | --- |
+| 2018-01-15T10:00:00Z | annotations | 2018-01-15T09:45:00Z - 2018-01-15T09:55:00Z | 2 | yes | critical tier |
+| 2018-01-15T10:05:00Z | annotations | 2018-01-15T09:50:00Z - 2018-01-15T10:00:00Z | 0 | no | a\|b |
+
+## Failed UUIDs
+
+| Content type | UUID | Transaction IDs | First seen | Last seen | Checks |
+| --- | --- | --- | --- | --- | ---: |
+| annotations | uuid1 | tid1, tid3 | 2018-01-15T10:00:00Z | 2018-01-15T10:00:00Z | 1 |
+`, out.String())
+}
+
+func TestWriteReport_CSV(t *testing.T) {
+
+	var out bytes.Buffer
+	assert.NoError(t, writeReport(&out, testReport, reportFormatCSV))
+	assert.Equal(t, `time,content_type,earliest_time,latest_time,failed_transactions,alert,tier,error
+2018-01-15T10:00:00Z,annotations,2018-01-15T09:45:00Z,2018-01-15T09:55:00Z,2,true,critical,
+2018-01-15T10:05:00Z,annotations,2018-01-15T09:50:00Z,2018-01-15T10:00:00Z,0,false,,a|b
+
+content_type,uuid,transaction_ids,first_seen,last_seen,checks
+annotations,uuid1,tid1 tid3,2018-01-15T10:00:00Z,2018-01-15T10:00:00Z,1
+`, out.String())
+}
+
+func TestWriteReport_JSON(t *testing.T) {
+
+	var out bytes.Buffer
+	assert.NoError(t, writeReport(&out, testReport, reportFormatJSON))
+
+	var report publishReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, testReport, report)
+}
+
+// contentTypeSource dispatches the fetches to a source per content type.
+type contentTypeSource struct {
+	sources map[string]TransactionSource
+}
+
+func (s *contentTypeSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+	return s.sources[contentType].FetchOpenTransactions(ctx, contentType, earliestTime, latestTime)
+}
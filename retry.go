@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"github.com/Financial-Times/go-logger"
+	"math/rand"
+	"time"
+)
+
+// retryPolicy retries the fetches failing with a transport error or a 5xx response, with an exponential backoff and jitter.
+// Other failures, like 4xx responses, are not worth retrying. The zero value does not retry at all.
+type retryPolicy struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// jitter picks the actual wait for a backoff, equal jitter is used when it is not set
+	jitter func(backoff time.Duration) time.Duration
+}
+
+// fetchAttempt is a single call to the source made by a fetch, with its duration and its error if it failed.
+type fetchAttempt struct {
+	duration time.Duration
+	err      error
+}
+
+// retryingSource is a source wrapping the whole retried fetch rather than every attempt, like the circuit breaker,
+// which counts a single outcome per fetch whatever the number of attempts.
+type retryingSource interface {
+	fetchWithRetries(ctx context.Context, p retryPolicy, ct contentTypeConfig) (transactions, []fetchAttempt, error)
+}
+
+// fetch fetches the open transactions, retrying while it is worth it and the context has time left for it.
+// It returns the number of attempts made along with the result of the last one.
+func (p retryPolicy) fetch(ctx context.Context, source TransactionSource, ct contentTypeConfig) (transactions, int, error) {
+	txs, attempts, err := p.fetchAttempts(ctx, source, ct)
+	return txs, len(attempts), err
+}
+
+// fetchAttempts is fetch, returning every attempt made rather than their number.
+// An attempt is timed on its own, without the backoff before the next one.
+func (p retryPolicy) fetchAttempts(ctx context.Context, source TransactionSource, ct contentTypeConfig) (transactions, []fetchAttempt, error) {
+
+	if rs, ok := source.(retryingSource); ok {
+		return rs.fetchWithRetries(ctx, p, ct)
+	}
+
+	var attempts []fetchAttempt
+	for {
+		start := time.Now()
+		txs, err := source.FetchOpenTransactions(ctx, ct.ContentType, ct.EarliestTime, ct.LatestTime)
+		attempts = append(attempts, fetchAttempt{duration: time.Since(start), err: err})
+		if err == nil || len(attempts) > p.retries || !isRetryable(err) {
+			return txs, attempts, err
+		}
+
+		wait := p.wait(len(attempts))
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			logger.WithError(err).Warnf("Not retrying %s transactions, the next attempt would not fit in the checking time budget", ct.ContentType)
+			return txs, attempts, err
+		}
+
+		logger.WithError(err).Warnf("Attempt %d to retrieve %s transactions failed, retrying in %v", len(attempts), ct.ContentType, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return txs, attempts, err
+		}
+	}
+}
+
+// wait returns how long to wait after the given failed attempt: the backoff doubles with every attempt, up to the maximum.
+func (p retryPolicy) wait(attempt int) time.Duration {
+
+	backoff := p.backoff
+	for i := 1; i < attempt && (p.maxBackoff <= 0 || backoff < p.maxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.maxBackoff > 0 && backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+
+	if p.jitter != nil {
+		return p.jitter(backoff)
+	}
+	return equalJitter(backoff)
+}
+
+// equalJitter waits at least half of the backoff, and a random amount up to the full backoff.
+func equalJitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+func isRetryable(err error) bool {
+	fe, ok := err.(*fetchError)
+	if !ok {
+		return false
+	}
+	return fe.reason == failureReasonTransport || (fe.reason == failureReasonStatus && fe.statusCode >= 500)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	logger "github.com/Financial-Times/go-logger/test"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// scriptedSource fails with the given errors, in order, then returns its transactions.
+type scriptedSource struct {
+	errs  []error
+	txs   transactions
+	calls int
+}
+
+func (s *scriptedSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return nil, s.errs[s.calls-1]
+	}
+	return s.txs, nil
+}
+
+var (
+	transportErr = &fetchError{reason: failureReasonTransport, err: errors.New("connection reset by peer")}
+	status503Err = &fetchError{reason: failureReasonStatus, statusCode: http.StatusServiceUnavailable, err: errors.New("unexpected status code 503")}
+	status404Err = &fetchError{reason: failureReasonStatus, statusCode: http.StatusNotFound, err: errors.New("unexpected status code 404")}
+	decodeErr    = &fetchError{reason: failureReasonDecode, err: errors.New("invalid character")}
+	noJitter     = func(backoff time.Duration) time.Duration { return backoff }
+)
+
+func TestRetryPolicy_Fetch(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	policy := retryPolicy{retries: 2, backoff: time.Millisecond, maxBackoff: 2 * time.Millisecond}
+
+	var tests = []struct {
+		scenario string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{"No failure", nil, 1, nil},
+		{"Transport error and 5xx are retried", []error{transportErr, status503Err}, 3, nil},
+		{"Gives up after the retries", []error{transportErr, status503Err, transportErr, transportErr}, 3, transportErr},
+		{"4xx is an immediate failure", []error{status404Err}, 1, status404Err},
+		{"Decode error is an immediate failure", []error{decodeErr}, 1, decodeErr},
+		{"Unknown error is an immediate failure", []error{errors.New("backend is down")}, 1, errors.New("backend is down")},
+		{"Retried until the 4xx", []error{status503Err, status404Err}, 2, status404Err},
+	}
+
+	for _, test := range tests {
+		source := &scriptedSource{errs: test.errs, txs: testTxs}
+
+		txs, attempts, err := policy.fetch(context.Background(), source, annotationsConfig)
+
+		assert.Equal(t, test.attempts, attempts, test.scenario)
+		assert.Equal(t, test.attempts, source.calls, test.scenario)
+		assert.Equal(t, test.err, err, test.scenario)
+		if test.err == nil {
+			assert.Equal(t, transactions(testTxs), txs, test.scenario)
+		}
+	}
+}
+
+func TestRetryPolicy_FetchAttempts(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	policy := retryPolicy{retries: 2, backoff: 50 * time.Millisecond, jitter: noJitter}
+
+	start := time.Now()
+	_, attempts, err := policy.fetchAttempts(context.Background(), &scriptedSource{errs: []error{transportErr, status503Err}, txs: testTxs}, annotationsConfig)
+
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 150*time.Millisecond, "the fetch waits for the backoffs")
+	if assert.Len(t, attempts, 3) {
+		assert.Equal(t, transportErr, attempts[0].err)
+		assert.Equal(t, status503Err, attempts[1].err)
+		assert.NoError(t, attempts[2].err)
+		for _, attempt := range attempts {
+			assert.True(t, attempt.duration < 50*time.Millisecond, "an attempt is timed without the backoff")
+		}
+	}
+}
+
+func TestRetryPolicy_FetchWithinBudget(t *testing.T) {
+
+	hook := logger.NewTestHook("healthchecker-test")
+	policy := retryPolicy{retries: 5, backoff: time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, attempts, err := policy.fetch(ctx, &scriptedSource{errs: []error{transportErr, transportErr}}, annotationsConfig)
+
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, transportErr, err)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.Equal(t, "Not retrying annotations transactions, the next attempt would not fit in the checking time budget", hook.LastEntry().Message)
+}
+
+func TestRetryPolicy_FetchCancelled(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+	policy := retryPolicy{retries: 5, backoff: time.Second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, attempts, err := policy.fetch(ctx, &scriptedSource{errs: []error{transportErr, transportErr}}, annotationsConfig)
+
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, transportErr, err)
+}
+
+func TestRetryPolicy_Wait(t *testing.T) {
+
+	policy := retryPolicy{backoff: 100 * time.Millisecond, maxBackoff: time.Second, jitter: noJitter}
+
+	assert.Equal(t, 100*time.Millisecond, policy.wait(1))
+	assert.Equal(t, 200*time.Millisecond, policy.wait(2))
+	assert.Equal(t, 400*time.Millisecond, policy.wait(3))
+	assert.Equal(t, 800*time.Millisecond, policy.wait(4))
+	assert.Equal(t, time.Second, policy.wait(5))
+	assert.Equal(t, time.Second, policy.wait(100))
+}
+
+func TestEqualJitter(t *testing.T) {
+
+	for i := 0; i < 100; i++ {
+		wait := equalJitter(time.Second)
+		assert.True(t, wait >= 500*time.Millisecond, "wait %v", wait)
+		assert.True(t, wait <= time.Second, "wait %v", wait)
+	}
+	assert.Equal(t, time.Duration(0), equalJitter(0))
+}
+
+func TestDetermineHealth_Retries(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+
+	calls := 0
+	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/lists/transactions" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("[]"))
+	}))
+	defer healthcheckerServer.Close()
+
+	source := newEventReaderSource(healthcheckerServer.URL, http.DefaultClient)
+	policy := retryPolicy{retries: 3, backoff: time.Millisecond}
+
+	res := determineHealth(context.Background(), source, policy, annotationsConfig, time.Now())
+	assert.True(t, res.Successful)
+	assert.Equal(t, 3, res.Attempts)
+	assert.Empty(t, res.Error)
+
+	calls = 0
+	res = determineHealth(context.Background(), source, policy, contentTypeConfig{ContentType: "lists", EarliestTime: annotationsConfig.EarliestTime, LatestTime: annotationsConfig.LatestTime}, time.Now())
+	assert.False(t, res.Successful)
+	assert.Equal(t, 1, res.Attempts)
+	assert.Equal(t, 1, calls)
+	assert.Contains(t, res.Error, "unexpected status code 400")
+}
+
+// hangingSource hangs on the given content type until its context ends, and fails on a context that already ended.
+type hangingSource struct {
+	contentType string
+}
+
+func (s *hangingSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+	if contentType == s.contentType {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &fetchError{reason: failureReasonTransport, err: err}
+	}
+	return transactions{}, nil
+}
+
+func TestDetermineHealthStatuses_SharesTheCheckBudget(t *testing.T) {
+
+	logger.NewTestHook("healthchecker-test")
+
+	service := healthcheckerService{
+		source:       &hangingSource{contentType: "annotations"},
+		checkBudget:  200 * time.Millisecond,
+		contentTypes: []contentTypeConfig{annotationsConfig, {ContentType: "lists", EarliestTime: annotationsConfig.EarliestTime, LatestTime: annotationsConfig.LatestTime}},
+	}
+
+	start := time.Now()
+	statuses := service.determineHealthStatuses()
+
+	assert.False(t, statuses["annotations"].Successful)
+	assert.Contains(t, statuses["annotations"].Error, "context deadline exceeded")
+	assert.True(t, statuses["lists"].Successful, "the hanging content type only used its share of the budget")
+	assert.True(t, time.Since(start) < 200*time.Millisecond)
+}
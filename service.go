@@ -1,15 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/Financial-Times/go-logger"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"strconv"
-	"strings"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,8 +15,21 @@ const (
 	latestTimePathVar   = "latestTime"
 	earliestTime        = "-15m"
 	latestTime          = "-5m"
-	contentType         = "annotations"
 	timestampFormat     = time.RFC3339Nano
+	// age reported for the statuses that were never determined
+	neverChecked = -1
+)
+
+// the reasons why the health of a content type could not be determined
+const (
+	failureReasonRequest     = "request"
+	failureReasonTransport   = "transport"
+	failureReasonStatus      = "status"
+	failureReasonRead        = "read"
+	failureReasonDecode      = "decode"
+	failureReasonUnknown     = "unknown"
+	failureReasonCircuitOpen = "circuit_open"
+	failureReasonSearch      = "search"
 )
 
 type healthchecker interface {
@@ -31,26 +41,45 @@ type healthmonitor interface {
 }
 
 type healthcheckerService struct {
-	eventReaderAddress string
-	healthStatus       healthStatus
-	slaWindow          int
+	// accessed atomically, kept first for 64-bit alignment
+	overruns uint64
+
+	source      TransactionSource
+	breaker     *circuitBreaker
+	events      *eventCorrelator
+	retries     retryPolicy
+	checkBudget time.Duration
+	// consecutive failed checks making a content type unreachable, and successful ones making it reachable again
+	unreachableAfter int
+	reachableAfter   int
+	contentTypes     []contentTypeConfig
+	healthStatuses   map[string]healthStatus
+	staleAfter       time.Duration
+	history          *healthHistory
+	trackers         map[string]*failureTracker
+	metrics          *publishMetrics
+	notifications    *notificationDispatcher
+	templates        *alertTemplates
+	silences         *silenceStore
+	checkLimiter     *rateLimiter
+	queryMaxRange    time.Duration
+	running          *checkRun
+	runLock          sync.Mutex
+	// simulated clock used when replaying recorded responses, time.Now otherwise
+	now func() time.Time
 	sync.RWMutex
 }
 
 func (s *healthcheckerService) monitorPublishHealth(ticker *time.Ticker) chan bool {
 
-	s.Lock()
-	s.healthStatus = determineHealth(s.eventReaderAddress, s.slaWindow, contentType, earliestTime, latestTime)
-	s.Unlock()
+	s.refreshHealthStatuses()
 
 	quit := make(chan bool)
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
-				s.Lock()
-				s.healthStatus = determineHealth(s.eventReaderAddress, s.slaWindow, contentType, earliestTime, latestTime)
-				s.Unlock()
+				go s.refreshHealthStatuses()
 			case <-quit:
 				ticker.Stop()
 				return
@@ -61,54 +90,167 @@ func (s *healthcheckerService) monitorPublishHealth(ticker *time.Ticker) chan bo
 	return quit
 }
 
-func (s *healthcheckerService) getHealthStatus() interface{} {
+// refreshHealthStatuses determines the health of every content type without holding the lock,
+// then swaps the new statuses in at once. The refresh is skipped if the previous one is still running.
+func (s *healthcheckerService) refreshHealthStatuses() bool {
 
-	s.RLock()
-	status := s.healthStatus
-	s.RUnlock()
+	s.runLock.Lock()
+	run, started := s.newRun(false)
+	s.runLock.Unlock()
 
-	return status
+	if !started {
+		overruns := atomic.AddUint64(&s.overruns, 1)
+		logger.Warnf("Skipping the health check, the previous one is still running. Overruns so far: %d", overruns)
+		return false
+	}
+
+	s.run(run)
+	return true
 }
 
-func determineHealth(eventReaderAddress string, slaWindow int, contentType string, earliestTime string, latestTime string) healthStatus {
+func (s *healthcheckerService) determineHealthStatuses() map[string]healthStatus {
 
-	now := time.Now()
-	checkingTime := now.Format(timestampFormat)
-	checkingPeriod := fmt.Sprintf("Between %s and %s", earliestTime, latestTime)
+	// the retries of all the content types have to fit in the time budget of a check
+	deadline := time.Now().Add(s.checkBudget)
 
-	req, err := http.NewRequest("GET", eventReaderAddress+"/"+contentType+"/transactions", nil)
+	statuses := make(map[string]healthStatus, len(s.contentTypes))
+	for i, ct := range s.contentTypes {
+		ctx, cancel := s.budgetContext(deadline, len(s.contentTypes)-i)
+		status := determineHealth(ctx, s.checkSource(), s.retries, ct, s.clock())
+		cancel()
+		// the results are as fresh as the end of the check, which can take a while with the retries
+		status.checkedAt = s.clock()
+		// a silenced failure is still open, so it is tracked before the silences leave it out of the thresholds
+		status = s.tracker(ct.ContentType).update(status, ct.EarliestTime.resolve(status.checkedAt))
+		if s.silences != nil {
+			status = s.silences.apply(status)
+		}
+		if s.breaker != nil {
+			breakerStatus := s.breaker.status()
+			status.CircuitBreaker = &breakerStatus
+		}
+		if s.metrics != nil {
+			s.metrics.observe(ct.ContentType, status)
+		}
 
-	q := req.URL.Query()
-	q.Add(earliestTimePathVar, fmt.Sprintf("%s", earliestTime))
-	q.Add(latestTimePathVar, fmt.Sprintf("%s", latestTime))
-	req.URL.RawQuery = q.Encode()
+		s.RLock()
+		previous, checked := s.healthStatuses[ct.ContentType]
+		s.RUnlock()
+		statuses[ct.ContentType] = s.updateReachability(ct.ContentType, previous, checked, status)
+	}
+	return statuses
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		logger.WithError(err).Errorf("Failed to retrieve transactions from %s", req.URL.String())
-		return healthStatus{[]transaction{}, checkingTime, checkingPeriod, false}
+// checkSource is the source of the checks: the circuit breaker when there is one. The ad-hoc queries and the reports call the source directly,
+// so that they cannot open the breaker of the live checks.
+func (s *healthcheckerService) checkSource() TransactionSource {
+	if s.breaker != nil {
+		return s.breaker
 	}
-	defer cleanUp(resp)
+	return s.source
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.WithError(err).Errorf("Failed to retrieve transactions from %s with status code %d", req.URL.String(), resp.StatusCode)
-		return healthStatus{[]transaction{}, checkingTime, checkingPeriod, false}
+// budgetContext gives a content type its share of the time left in the budget of a check, split evenly with the content types still to check.
+// The time a content type does not use is left to the next ones, and a slow one cannot use up the time of the others.
+func (s *healthcheckerService) budgetContext(deadline time.Time, remaining int) (context.Context, context.CancelFunc) {
+	if s.checkBudget <= 0 {
+		return context.WithCancel(context.Background())
 	}
+	return context.WithTimeout(context.Background(), time.Until(deadline)/time.Duration(remaining))
+}
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logger.WithError(err).Errorf("Error parsing transaction body for url %s", req.URL.String())
-		return healthStatus{[]transaction{}, checkingTime, checkingPeriod, false}
+// tracker returns the failure tracker of a content type. The checks can run concurrently, e.g. the check and report commands
+// do not go through refreshHealthStatuses, so the trackers are looked up under the lock.
+func (s *healthcheckerService) tracker(contentType string) *failureTracker {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.trackers == nil {
+		s.trackers = map[string]*failureTracker{}
+	}
+	tracker, found := s.trackers[contentType]
+	if !found {
+		tracker = newFailureTracker()
+		s.trackers[contentType] = tracker
+	}
+	return tracker
+}
+
+func (s *healthcheckerService) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
 	}
+	return s.now()
+}
 
-	var txs transactions
-	if err := json.Unmarshal(b, &txs); err != nil {
-		logger.WithError(err).Errorf("Error unmarshalling transaction log messages for url %s", req.URL.String())
-		return healthStatus{[]transaction{}, checkingTime, checkingPeriod, false}
+// alertTemplates returns the templates of the texts of the checks, the built-in ones unless others were loaded.
+func (s *healthcheckerService) alertTemplates() *alertTemplates {
+	if s.templates == nil {
+		return defaultAlertTemplates
 	}
+	return s.templates
+}
 
-	// ignore recent transactions that might be already closed - even if they are unclosed when the query happens
-	txs = ignoreRecentTransactions(txs, now, latestTime, slaWindow)
+func (s *healthcheckerService) getOverruns() uint64 {
+	return atomic.LoadUint64(&s.overruns)
+}
+
+func (s *healthcheckerService) getHealthStatus() interface{} {
+
+	now := time.Now()
+
+	s.RLock()
+	statuses := make(map[string]healthStatus, len(s.healthStatuses))
+	for ct, status := range s.healthStatuses {
+		age := s.checkAge(status, now)
+		status.CheckAgeSeconds = neverChecked
+		if !status.checkedAt.IsZero() {
+			status.CheckAgeSeconds = int64(age / time.Second)
+		}
+		status.Stale = s.isStale(age)
+		statuses[ct] = status
+	}
+	s.RUnlock()
+
+	return statuses
+}
+
+// checkAge tells how long ago the given status was determined. A status that was never determined is infinitely old.
+func (s *healthcheckerService) checkAge(status healthStatus, now time.Time) time.Duration {
+	if status.checkedAt.IsZero() {
+		return time.Duration(math.MaxInt64)
+	}
+	return now.Sub(status.checkedAt)
+}
+
+func (s *healthcheckerService) isStale(age time.Duration) bool {
+	return s.staleAfter > 0 && age > s.staleAfter
+}
+
+func (s *healthcheckerService) getContentTypeHealthStatus(contentType string) healthStatus {
+
+	s.RLock()
+	status := s.healthStatuses[contentType]
+	s.RUnlock()
+
+	return status
+}
+
+func determineHealth(ctx context.Context, source TransactionSource, retries retryPolicy, ct contentTypeConfig, now time.Time) healthStatus {
+
+	checkingTime := now.Format(timestampFormat)
+	checkingPeriod := fmt.Sprintf("Between %s and %s", ct.EarliestTime, ct.LatestTime)
+
+	txs, attempts, err := fetchFailedTransactions(ctx, source, retries, ct, now)
+	if err != nil {
+		if failureReasonOf(err) == failureReasonCircuitOpen {
+			logger.Warnf("Skipped retrieving %s transactions: %v", ct.ContentType, err)
+		} else {
+			logger.WithError(err).Errorf("Failed to retrieve %s transactions after %d attempt(s)", ct.ContentType, len(attempts))
+		}
+		return healthStatus{OpenTransactions: []transaction{}, CheckingPeriod: checkingPeriod, LastTimeCheck: checkingTime, Successful: false, Attempts: len(attempts), Error: err.Error(), checkedAt: now, failureReason: failureReasonOf(err), fetchAttempts: attempts}
+	}
 
 	if len(txs) > 0 {
 		tids := []string{}
@@ -118,21 +260,26 @@ func determineHealth(eventReaderAddress string, slaWindow int, contentType strin
 		logger.Errorf("Transactions %+v are unhealthy at %v.", tids, checkingTime)
 	}
 
-	return healthStatus{txs, checkingTime, checkingPeriod, true}
+	return healthStatus{OpenTransactions: txs, CheckingPeriod: checkingPeriod, LastTimeCheck: checkingTime, Successful: true, Attempts: len(attempts), checkedAt: now, fetchAttempts: attempts}
 }
 
-func ignoreRecentTransactions(txs transactions, referenceTime time.Time, delay string, slaWindow int) transactions {
+// fetchFailedTransactions fetches the open transactions in the checking window of the content type, evaluated at the given time,
+// and keeps the ones that should have been closed by then.
+func fetchFailedTransactions(ctx context.Context, source TransactionSource, retries retryPolicy, ct contentTypeConfig, now time.Time) (transactions, []fetchAttempt, error) {
 
-	// compute the delay that the requests are executed with
-	delay = strings.Split(latestTime, "m")[0]
-	d, err := strconv.Atoi(delay)
+	txs, attempts, err := retries.fetchAttempts(ctx, source, ct)
 	if err != nil {
-		logger.WithError(err).Errorf("LatestTime (%s) was not parsable, couldn't be determined the delay that the requests are executed with. No transactions are filtered out from the resultset.", latestTime)
-		return txs
+		return nil, attempts, err
 	}
 
-	// compute the time when the checking period starts - example: the checks are done with a 5 minutes delay
-	referenceTime = referenceTime.Add(time.Duration(d) * time.Minute)
+	// ignore recent transactions that might be already closed - even if they are unclosed when the query happens
+	return ignoreRecentTransactions(txs, now, ct.LatestTime, ct.SLAWindow), attempts, nil
+}
+
+func ignoreRecentTransactions(txs transactions, referenceTime time.Time, latestTime relativeTime, slaWindow int) transactions {
+
+	// compute the time when the checking period ends - example: the checks are done with a 5 minutes delay
+	referenceTime = latestTime.resolve(referenceTime)
 
 	// ignore the SLA Window - publishes inside that could still successfully make through, even if they are unclosed yet
 	referenceTime = referenceTime.Add(-time.Duration(slaWindow) * time.Minute)
@@ -152,15 +299,3 @@ func ignoreRecentTransactions(txs transactions, referenceTime time.Time, delay s
 	}
 	return res
 }
-
-func cleanUp(resp *http.Response) {
-	_, err := io.Copy(ioutil.Discard, resp.Body)
-	if err != nil {
-		logger.Warnf("[%v]", err)
-	}
-
-	err = resp.Body.Close()
-	if err != nil {
-		logger.Warnf("[%v]", err)
-	}
-}
@@ -1,117 +1,88 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	logger "github.com/Financial-Times/go-logger/test"
 	"github.com/stretchr/testify/assert"
 	"net/http"
-	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
 
-type input struct {
-	eventReaderAddress string
-	contentType        string
-	earliestTime       string
-	latestTime         string
-	slaWindow          int
+// fakeSource is an in-memory TransactionSource. When release is set, the fetches block until it is closed.
+type fakeSource struct {
+	txs     map[string]transactions
+	errs    map[string]error
+	release chan struct{}
+	calls   []string
+	sync.Mutex
 }
 
-type output struct {
-	status    healthStatus
-	err       string
-	outputMsg string
+func (f *fakeSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+
+	if f.release != nil {
+		<-f.release
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.calls = append(f.calls, fmt.Sprintf("%s %s %s", contentType, earliestTime, latestTime))
+	if err, found := f.errs[contentType]; found {
+		return nil, err
+	}
+	return f.txs[contentType], nil
 }
 
 func TestDetermineHealth_Unhealthy(t *testing.T) {
 
 	hook := logger.NewTestHook("healthchecker-test")
 
-	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(""))
-	}))
-	defer healthcheckerServer.Close()
-
-	slaWindow := 2
+	ct := contentTypeConfig{
+		ContentType:  "annotations",
+		EarliestTime: mustParseRelativeTime("-15m"),
+		LatestTime:   mustParseRelativeTime("-5m"),
+		SLAWindow:    2,
+	}
 
 	var tests = []struct {
 		scenario string
-		in       input
-		out      output
+		err      error
+		reason   string
 	}{
-		{"Incorrect address - wrong protocol",
-			input{"address", "annotations", "earliest-time", "latest-time", slaWindow},
-			output{healthStatus{
-				[]transaction{},
-				time.Now().Format(timestampFormat),
-				"Between earliest-time and latest-time",
-				false,
-			},
-				"unsupported protocol scheme", "Failed to retrieve transactions from",
-			},
-		},
-		{"Incorrect address - no response",
-			input{"http://localhost:8080", "annotations", "earliest-time", "latest-time", slaWindow},
-			output{healthStatus{
-				[]transaction{},
-				time.Now().Format(timestampFormat),
-				"Between earliest-time and latest-time",
-				false,
-			},
-				"connection refused", "Failed to retrieve transactions from",
-			},
-		},
-		{"Server errors: 503",
-			input{healthcheckerServer.URL, "annotations", "earliest-time", "latest-time", slaWindow},
-			output{healthStatus{
-				[]transaction{},
-				time.Now().Format(timestampFormat),
-				"Between earliest-time and latest-time",
-				false,
-			},
-				"", "Failed to retrieve transactions from",
-			},
-		},
+		{"Event reader failure", &fetchError{reason: failureReasonStatus, location: "http://event-reader", statusCode: 503, err: errors.New("unexpected status code 503")}, failureReasonStatus},
+		{"Unknown failure", errors.New("backend is down"), failureReasonUnknown},
 	}
 
 	for _, test := range tests {
 
-		res := determineHealth(test.in.eventReaderAddress, test.in.slaWindow, test.in.contentType, test.in.earliestTime, test.in.latestTime)
-		if test.out.outputMsg == "" {
-			assert.Equal(t, 0, len(hook.Entries))
-		} else {
-			e := hook.LastEntry()
-			assert.Contains(t, e.Message, test.out.outputMsg)
-			assert.Equal(t, e.Level.String(), "error")
-		}
+		source := &fakeSource{errs: map[string]error{"annotations": test.err}}
+		res := determineHealth(context.Background(), source, retryPolicy{}, ct, checkTime)
 
-		if test.out.err != "" {
-			e := hook.LastEntry()
-			assert.Contains(t, e.Data["error"].(error).Error(), test.out.err)
-		}
+		e := hook.LastEntry()
+		assert.Equal(t, "Failed to retrieve annotations transactions after 1 attempt(s)", e.Message, test.scenario)
+		assert.Equal(t, "error", e.Level.String(), test.scenario)
+		assert.Equal(t, test.err, e.Data["error"], test.scenario)
 
-		assertEqual(t, test.out.status, res)
+		assertEqual(t, healthStatus{OpenTransactions: []transaction{}, CheckingPeriod: "Between -15m and -5m", LastTimeCheck: "2018-01-15T16:00:00Z", Successful: false}, res)
+		assert.Equal(t, test.reason, res.failureReason, test.scenario)
+		assert.Equal(t, 1, res.Attempts, test.scenario)
+		assert.Equal(t, test.err.Error(), res.Error, test.scenario)
+		assert.Equal(t, []string{"annotations -15m -5m"}, source.calls, test.scenario)
 	}
 }
 
-func TestDetermineHealth_IncorrectResponse(t *testing.T) {
+// checkTime is the time of the checks with a fixed clock
+var checkTime = time.Date(2018, 1, 15, 16, 0, 0, 0, time.UTC)
 
-	hook := logger.NewTestHook("healthchecker-test")
-	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("some unparsable message"))
-	}))
-	defer healthcheckerServer.Close()
-
-	res := determineHealth(healthcheckerServer.URL, 2, "anyType", "earliestTime", "latestTime")
-	assert.Equal(t, 1, len(hook.Entries))
-	assert.Contains(t, hook.LastEntry().Message, "Error unmarshalling transaction log messages for url")
-	assert.Contains(t, hook.LastEntry().Data["error"].(error).Error(), "invalid character")
-
-	assertEqual(t, healthStatus{[]transaction{}, "", "Between earliestTime and latestTime", false}, res)
+var anyTypeConfig = contentTypeConfig{
+	ContentType:  "anyType",
+	EarliestTime: mustParseRelativeTime("-1h@h"),
+	LatestTime:   mustParseRelativeTime("-300s"),
+	SLAWindow:    2,
 }
 
 func TestDetermineHealth_200(t *testing.T) {
@@ -130,18 +101,10 @@ func TestDetermineHealth_200(t *testing.T) {
 		},
 	}
 
-	msg, err := json.Marshal(txs)
-	assert.Nil(t, err)
-
-	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write(msg)
-	}))
-	defer healthcheckerServer.Close()
-
-	res := determineHealth(healthcheckerServer.URL, 2, "anyType", "earliestTime", "latestTime")
+	res := determineHealth(context.Background(), &fakeSource{txs: map[string]transactions{"anyType": txs}}, retryPolicy{}, anyTypeConfig, checkTime)
 	assert.Equal(t, 1, len(hook.Entries))
-	assertEqual(t, healthStatus{txs, "", "Between earliestTime and latestTime", true}, res)
+	assert.Equal(t, "Transactions [tid1 tid2] are unhealthy at 2018-01-15T16:00:00Z.", hook.LastEntry().Message)
+	assertEqual(t, healthStatus{OpenTransactions: txs, CheckingPeriod: "Between -1h@h and -300s", LastTimeCheck: "2018-01-15T16:00:00Z", Successful: true}, res)
 }
 
 func TestMonitorPublishHealth(t *testing.T) {
@@ -159,18 +122,12 @@ func TestMonitorPublishHealth(t *testing.T) {
 		},
 	}
 
-	msg, err := json.Marshal(txs)
-	assert.Nil(t, err)
-
-	healthcheckerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write(msg)
-	}))
-	defer healthcheckerServer.Close()
-
 	service := healthcheckerService{
-		eventReaderAddress: healthcheckerServer.URL,
-		healthStatus:       healthStatus{},
+		source:         &fakeSource{txs: map[string]transactions{"annotations": txs}},
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{},
+		history:        newHealthHistory(3, 0),
+		now:            func() time.Time { return checkTime },
 	}
 
 	ticker := time.NewTicker(1 * time.Second)
@@ -179,7 +136,143 @@ func TestMonitorPublishHealth(t *testing.T) {
 	time.Sleep(5 * time.Second)
 	quit <- true
 
-	assertEqual(t, service.getHealthStatus().(healthStatus), healthStatus{txs, "", fmt.Sprintf("Between %s and %s", earliestTime, latestTime), true})
+	assertEqual(t, service.getContentTypeHealthStatus("annotations"), healthStatus{OpenTransactions: txs, CheckingPeriod: fmt.Sprintf("Between %s and %s", earliestTime, latestTime), LastTimeCheck: "2018-01-15T16:00:00Z", Successful: true})
+
+	entries := service.history.query(time.Time{}, time.Time{}, 0)
+	assert.Len(t, entries, 3)
+	assertEqual(t, entries[2].Statuses["annotations"], service.getContentTypeHealthStatus("annotations"))
+}
+
+func TestDetermineHealthStatuses_MultipleContentTypes(t *testing.T) {
+
+	txs := []transaction{
+		{
+			TransactionID: "tid1",
+			UUID:          "uuid1",
+			LastModified:  "2017-01-15T14:57:42.567Z",
+		},
+	}
+
+	source := &fakeSource{
+		txs:  map[string]transactions{"annotations": txs},
+		errs: map[string]error{"lists": &fetchError{reason: failureReasonStatus, statusCode: http.StatusServiceUnavailable, err: errors.New("unexpected status code 503")}},
+	}
+
+	service := healthcheckerService{
+		source: source,
+		contentTypes: []contentTypeConfig{
+			annotationsConfig,
+			{ContentType: "lists", EarliestTime: annotationsConfig.EarliestTime, LatestTime: annotationsConfig.LatestTime},
+		},
+	}
+
+	statuses := service.determineHealthStatuses()
+	assert.Equal(t, []string{"tid1"}, trackedIDs(service.determineHealthStatuses()["annotations"].Ongoing))
+
+	assert.Equal(t, []string{"annotations -15m -5m", "lists -15m -5m", "annotations -15m -5m", "lists -15m -5m"}, source.calls)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses["annotations"].Successful)
+	assert.Equal(t, txs, statuses["annotations"].OpenTransactions)
+	assert.Equal(t, []string{"tid1"}, trackedIDs(statuses["annotations"].New))
+	assert.False(t, statuses["lists"].Successful)
+	assert.Empty(t, statuses["lists"].OpenTransactions)
+}
+
+func TestDetermineHealthStatuses_Concurrent(t *testing.T) {
+
+	// the check command and direct calls do not go through refreshHealthStatuses, so the checks can overlap
+	service := healthcheckerService{
+		source:       &fakeSource{txs: map[string]transactions{"annotations": testTxs}},
+		contentTypes: []contentTypeConfig{annotationsConfig, {ContentType: "lists", EarliestTime: annotationsConfig.EarliestTime, LatestTime: annotationsConfig.LatestTime}},
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.determineHealthStatuses()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, service.trackers, 2)
+	assert.Len(t, service.determineHealthStatuses()["annotations"].Ongoing, 2)
+}
+
+func TestRefreshHealthStatuses_DoesNotBlockReaders(t *testing.T) {
+
+	hook := logger.NewTestHook("healthchecker-test")
+	release := make(chan struct{})
+	previous := healthStatus{OpenTransactions: testTxs, Successful: true}
+	service := healthcheckerService{
+		source:         &fakeSource{release: release},
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{"annotations": previous},
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- service.refreshHealthStatuses()
+	}()
+
+	// the first refresh is stuck on the event reader: a second one is skipped, and readers still get the previous status
+	for i := 0; i < 100 && !isRunning(&service); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, service.refreshHealthStatuses())
+	assert.Equal(t, uint64(1), service.getOverruns())
+	assert.Contains(t, hook.LastEntry().Message, "Skipping the health check, the previous one is still running. Overruns so far: 1")
+	assert.Equal(t, previous, service.getContentTypeHealthStatus("annotations"))
+
+	close(release)
+	assert.True(t, <-done)
+	assert.Empty(t, service.getContentTypeHealthStatus("annotations").OpenTransactions)
+	assert.True(t, service.refreshHealthStatuses())
+}
+
+func TestGetHealthStatus_CheckAge(t *testing.T) {
+
+	now := time.Now()
+	service := healthcheckerService{
+		healthStatuses: map[string]healthStatus{
+			"annotations": {Successful: true, checkedAt: now.Add(-90 * time.Second)},
+			"lists":       {Successful: true, checkedAt: now.Add(-5 * time.Minute)},
+			"content":     {},
+		},
+		staleAfter: 3 * time.Minute,
+	}
+
+	statuses := service.getHealthStatus().(map[string]healthStatus)
+
+	assert.Equal(t, int64(90), statuses["annotations"].CheckAgeSeconds)
+	assert.False(t, statuses["annotations"].Stale)
+	assert.Equal(t, int64(300), statuses["lists"].CheckAgeSeconds)
+	assert.True(t, statuses["lists"].Stale)
+	assert.Equal(t, int64(-1), statuses["content"].CheckAgeSeconds, "never checked")
+	assert.True(t, statuses["content"].Stale)
+}
+
+func TestDetermineHealthStatuses_FreshAsOfCompletion(t *testing.T) {
+
+	release := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+
+	service := healthcheckerService{
+		source:       &fakeSource{release: release},
+		contentTypes: []contentTypeConfig{annotationsConfig},
+	}
+
+	start := time.Now()
+	status := service.determineHealthStatuses()["annotations"]
+
+	assert.True(t, status.checkedAt.Sub(start) >= 100*time.Millisecond, "the status is stamped when the check completes")
+	checkingTime, err := time.Parse(timestampFormat, status.LastTimeCheck)
+	assert.NoError(t, err)
+	assert.True(t, checkingTime.Sub(start) < 100*time.Millisecond, "the window is still evaluated at the start of the check")
 }
 
 func TestIgnoreRecentTransactions(t *testing.T) {
@@ -188,7 +281,7 @@ func TestIgnoreRecentTransactions(t *testing.T) {
 	refTime, err := time.Parse(timestampFormat, timeCheck)
 	assert.Nil(t, err)
 
-	delay := "-5m"
+	delay := mustParseRelativeTime("-5m")
 	slaWindow := 2 //minutes
 
 	validTXS := []transaction{
@@ -236,8 +329,32 @@ func TestIgnoreRecentTransactions(t *testing.T) {
 	assert.Equal(t, transactions(validTXS), actualTXS)
 }
 
+func TestIgnoreRecentTransactions_SnapToAndSeconds(t *testing.T) {
+
+	refTime, err := time.Parse(timestampFormat, "2017-02-13T12:07:30.000Z")
+	assert.Nil(t, err)
+
+	txs := []transaction{
+		{TransactionID: "tid1", LastModified: "2017-02-13T11:58:00.000Z"},
+		{TransactionID: "tid2", LastModified: "2017-02-13T11:58:01.000Z"},
+	}
+
+	// -@h snaps to 12:00, minus the 2 minutes SLA window
+	assert.Equal(t, transactions(txs[:1]), ignoreRecentTransactions(txs, refTime, mustParseRelativeTime("@h"), 2))
+
+	// -570s is 11:58:00, minus no SLA window
+	assert.Equal(t, transactions(txs[:1]), ignoreRecentTransactions(txs, refTime, mustParseRelativeTime("-570s"), 0))
+}
+
+func isRunning(s *healthcheckerService) bool {
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+	return s.running != nil
+}
+
 func assertEqual(t *testing.T, s1 healthStatus, s2 healthStatus) {
 	assert.Equal(t, s1.OpenTransactions, s2.OpenTransactions)
 	assert.Equal(t, s1.LastTimeCheck, s2.LastTimeCheck)
+	assert.Equal(t, s1.CheckingPeriod, s2.CheckingPeriod)
 	assert.Equal(t, s1.Successful, s2.Successful)
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSilenceBodySize limits the size of a silence posted to POST /__silences
+const maxSilenceBodySize = 64 * 1024
+
+// silence excludes the matching failed transactions from the failure thresholds until it expires.
+// It matches a transaction ID, a UUID, or UUIDs with a glob pattern, e.g. 9a5e3b4a-*.
+type silence struct {
+	ID            string    `json:"id"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	UUID          string    `json:"uuid,omitempty"`
+	UUIDPattern   string    `json:"uuid_pattern,omitempty"`
+	Author        string    `json:"author"`
+	Comment       string    `json:"comment"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// silenceRequest is a silence as posted, expiring at a given time or after a duration.
+type silenceRequest struct {
+	TransactionID string `json:"transaction_id"`
+	UUID          string `json:"uuid"`
+	UUIDPattern   string `json:"uuid_pattern"`
+	Author        string `json:"author"`
+	Comment       string `json:"comment"`
+	ExpiresAt     string `json:"expires_at"`
+	Duration      string `json:"duration"`
+}
+
+// silencedTransaction is a failed transaction left out of the thresholds, along with the silence matching it.
+type silencedTransaction struct {
+	transaction
+	SilenceID      string `json:"silence_id"`
+	SilencedBy     string `json:"silenced_by"`
+	SilenceComment string `json:"silence_comment"`
+	SilencedUntil  string `json:"silenced_until"`
+}
+
+// silenceStore keeps the silences in memory, they do not survive a restart.
+type silenceStore struct {
+	silences    map[string]silence
+	maxDuration time.Duration
+	now         func() time.Time
+	sync.Mutex
+}
+
+func newSilenceStore(maxDuration time.Duration) *silenceStore {
+	return &silenceStore{silences: map[string]silence{}, maxDuration: maxDuration, now: time.Now}
+}
+
+// create reads a silence request and adds the silence. The errors are all due to an invalid request.
+func (st *silenceStore) create(r io.Reader) (silence, error) {
+
+	var req silenceRequest
+	decoder := json.NewDecoder(r)
+	if err := decoder.Decode(&req); err != nil {
+		return silence{}, fmt.Errorf("silence is not valid JSON: %v", err)
+	}
+
+	now := st.now()
+	s, err := req.silence(now, st.maxDuration)
+	if err != nil {
+		return silence{}, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return silence{}, err
+	}
+	s.ID = hex.EncodeToString(id)
+
+	st.Lock()
+	defer st.Unlock()
+
+	st.expire(now)
+	st.silences[s.ID] = s
+	return s, nil
+}
+
+func (req silenceRequest) silence(now time.Time, maxDuration time.Duration) (silence, error) {
+
+	matchers := 0
+	for _, value := range []string{req.TransactionID, req.UUID, req.UUIDPattern} {
+		if value != "" {
+			matchers++
+		}
+	}
+	if matchers != 1 {
+		return silence{}, fmt.Errorf("a silence needs exactly one of transaction_id, uuid or uuid_pattern")
+	}
+	if req.UUIDPattern != "" {
+		if _, err := path.Match(req.UUIDPattern, ""); err != nil {
+			return silence{}, fmt.Errorf("uuid_pattern %q is not a valid pattern", req.UUIDPattern)
+		}
+	}
+	if strings.TrimSpace(req.Author) == "" || strings.TrimSpace(req.Comment) == "" {
+		return silence{}, fmt.Errorf("a silence needs an author and a comment")
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.ExpiresAt != "" && req.Duration != "":
+		return silence{}, fmt.Errorf("a silence needs either expires_at or duration, not both")
+	case req.ExpiresAt != "":
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return silence{}, fmt.Errorf("expires_at should be an RFC3339 timestamp, got %q", req.ExpiresAt)
+		}
+		expiresAt = t
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return silence{}, fmt.Errorf("duration should be a duration like 90m or 2h, got %q", req.Duration)
+		}
+		expiresAt = now.Add(d)
+	default:
+		return silence{}, fmt.Errorf("a silence needs either expires_at or duration")
+	}
+	if !expiresAt.After(now) {
+		return silence{}, fmt.Errorf("a silence should expire in the future")
+	}
+	if maxDuration > 0 && expiresAt.Sub(now) > maxDuration {
+		return silence{}, fmt.Errorf("a silence should expire within %v", maxDuration)
+	}
+
+	return silence{
+		TransactionID: req.TransactionID,
+		UUID:          req.UUID,
+		UUIDPattern:   req.UUIDPattern,
+		Author:        req.Author,
+		Comment:       req.Comment,
+		CreatedAt:     now.UTC(),
+		ExpiresAt:     expiresAt.UTC(),
+	}, nil
+}
+
+// list returns the active silences, oldest first.
+func (st *silenceStore) list() []silence {
+
+	st.Lock()
+	defer st.Unlock()
+
+	st.expire(st.now())
+	return st.sorted()
+}
+
+// remove deletes a silence, it tells whether the silence was active.
+func (st *silenceStore) remove(id string) bool {
+
+	st.Lock()
+	defer st.Unlock()
+
+	st.expire(st.now())
+	_, found := st.silences[id]
+	delete(st.silences, id)
+	return found
+}
+
+// apply moves the failed transactions matched by an active silence out of the open transactions, so that they do not count against the thresholds.
+func (st *silenceStore) apply(status healthStatus) healthStatus {
+
+	if len(status.OpenTransactions) == 0 {
+		return status
+	}
+
+	st.Lock()
+	st.expire(st.now())
+	silences := st.sorted()
+	st.Unlock()
+
+	if len(silences) == 0 {
+		return status
+	}
+
+	open := []transaction{}
+	for _, tx := range status.OpenTransactions {
+		matched := false
+		for _, s := range silences {
+			if s.matches(tx) {
+				status.Silenced = append(status.Silenced, silencedTransaction{
+					transaction:    tx,
+					SilenceID:      s.ID,
+					SilencedBy:     s.Author,
+					SilenceComment: s.Comment,
+					SilencedUntil:  s.ExpiresAt.Format(timestampFormat),
+				})
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			open = append(open, tx)
+		}
+	}
+	status.OpenTransactions = open
+	return status
+}
+
+func (st *silenceStore) expire(now time.Time) {
+	for id, s := range st.silences {
+		if !s.ExpiresAt.After(now) {
+			delete(st.silences, id)
+		}
+	}
+}
+
+func (st *silenceStore) sorted() []silence {
+
+	silences := []silence{}
+	for _, s := range st.silences {
+		silences = append(silences, s)
+	}
+	sort.Slice(silences, func(i, j int) bool {
+		return silences[i].CreatedAt.Before(silences[j].CreatedAt) || (silences[i].CreatedAt.Equal(silences[j].CreatedAt) && silences[i].ID < silences[j].ID)
+	})
+	return silences
+}
+
+// matches compares the UUIDs regardless of their case.
+func (s silence) matches(tx transaction) bool {
+	switch {
+	case s.TransactionID != "":
+		return s.TransactionID == tx.TransactionID
+	case s.UUID != "":
+		return strings.EqualFold(s.UUID, tx.UUID)
+	default:
+		matched, _ := path.Match(strings.ToLower(s.UUIDPattern), strings.ToLower(tx.UUID))
+		return matched
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+var silenceNow = time.Date(2018, 1, 15, 14, 30, 0, 0, time.UTC)
+
+func newTestSilenceStore() *silenceStore {
+	st := newSilenceStore(24 * time.Hour)
+	st.now = func() time.Time { return silenceNow }
+	return st
+}
+
+func mustCreateSilence(t *testing.T, st *silenceStore, body string) silence {
+	s, err := st.create(strings.NewReader(body))
+	assert.NoError(t, err, body)
+	return s
+}
+
+func TestSilenceStore_Create(t *testing.T) {
+
+	st := newTestSilenceStore()
+
+	s := mustCreateSilence(t, st, `{"uuid":"uuid1","author":"jane.doe","comment":"test content","duration":"2h"}`)
+
+	assert.Len(t, s.ID, 16)
+	assert.Equal(t, silence{ID: s.ID, UUID: "uuid1", Author: "jane.doe", Comment: "test content", CreatedAt: silenceNow, ExpiresAt: silenceNow.Add(2 * time.Hour)}, s)
+
+	s = mustCreateSilence(t, st, `{"transaction_id":"tid1","author":"jane.doe","comment":"known bad annotation","expires_at":"2018-01-15T16:00:00+01:00"}`)
+	assert.Equal(t, time.Date(2018, 1, 15, 15, 0, 0, 0, time.UTC), s.ExpiresAt)
+}
+
+func TestSilenceStore_CreateInvalid(t *testing.T) {
+
+	var tests = []struct {
+		body        string
+		expectedErr string
+	}{
+		{`{"uuid":`, "silence is not valid JSON: unexpected EOF"},
+		{`{"author":"jane.doe","comment":"test","duration":"1h"}`, "a silence needs exactly one of transaction_id, uuid or uuid_pattern"},
+		{`{"uuid":"uuid1","transaction_id":"tid1","author":"jane.doe","comment":"test","duration":"1h"}`, "a silence needs exactly one of transaction_id, uuid or uuid_pattern"},
+		{`{"uuid_pattern":"[uuid","author":"jane.doe","comment":"test","duration":"1h"}`, `uuid_pattern "[uuid" is not a valid pattern`},
+		{`{"uuid":"uuid1","author":" ","comment":"test","duration":"1h"}`, "a silence needs an author and a comment"},
+		{`{"uuid":"uuid1","author":"jane.doe","duration":"1h"}`, "a silence needs an author and a comment"},
+		{`{"uuid":"uuid1","author":"jane.doe","comment":"test"}`, "a silence needs either expires_at or duration"},
+		{`{"uuid":"uuid1","author":"jane.doe","comment":"test","duration":"1h","expires_at":"2018-01-15T16:00:00Z"}`, "a silence needs either expires_at or duration, not both"},
+		{`{"uuid":"uuid1","author":"jane.doe","comment":"test","duration":"1 hour"}`, `duration should be a duration like 90m or 2h, got "1 hour"`},
+		{`{"uuid":"uuid1","author":"jane.doe","comment":"test","expires_at":"tomorrow"}`, `expires_at should be an RFC3339 timestamp, got "tomorrow"`},
+		{`{"uuid":"uuid1","author":"jane.doe","comment":"test","expires_at":"2018-01-15T14:00:00Z"}`, "a silence should expire in the future"},
+		{`{"uuid":"uuid1","author":"jane.doe","comment":"test","duration":"25h"}`, "a silence should expire within 24h0m0s"},
+	}
+
+	st := newTestSilenceStore()
+	for _, test := range tests {
+		_, err := st.create(strings.NewReader(test.body))
+		assert.EqualError(t, err, test.expectedErr, test.body)
+	}
+	assert.Empty(t, st.list())
+}
+
+func TestSilenceStore_ListAndRemove(t *testing.T) {
+
+	st := newTestSilenceStore()
+	first := mustCreateSilence(t, st, `{"uuid":"uuid1","author":"jane.doe","comment":"test content","duration":"2h"}`)
+	st.now = func() time.Time { return silenceNow.Add(time.Minute) }
+	second := mustCreateSilence(t, st, `{"uuid":"uuid2","author":"jane.doe","comment":"test content","duration":"30m"}`)
+
+	assert.Equal(t, []silence{first, second}, st.list())
+
+	st.now = func() time.Time { return silenceNow.Add(31 * time.Minute) }
+	assert.Equal(t, []silence{first}, st.list(), "the second silence expired")
+	assert.False(t, st.remove(second.ID))
+
+	assert.True(t, st.remove(first.ID))
+	assert.Equal(t, []silence{}, st.list())
+}
+
+func TestSilenceStore_Apply(t *testing.T) {
+
+	st := newTestSilenceStore()
+	byUUID := mustCreateSilence(t, st, `{"uuid":"9A5E3B4A-55DA-498D-8B79-1F5B0EC4EB23","author":"jane.doe","comment":"test content","duration":"2h"}`)
+	st.now = func() time.Time { return silenceNow.Add(time.Minute) }
+	byPattern := mustCreateSilence(t, st, `{"uuid_pattern":"0000*","author":"john.doe","comment":"synthetic publishes","duration":"2h"}`)
+	mustCreateSilence(t, st, `{"transaction_id":"tid_other","author":"john.doe","comment":"unrelated","duration":"2h"}`)
+
+	status := healthStatus{
+		OpenTransactions: []transaction{
+			{TransactionID: "tid_1", UUID: "9a5e3b4a-55da-498d-8b79-1f5b0ec4eb23"},
+			{TransactionID: "tid_2", UUID: "00000000-0000-0000-0000-000000000001"},
+			{TransactionID: "tid_3", UUID: "1b7a1c6e-0d4f-4b5e-9e1a-3c0c8e7d9f20"},
+		},
+		Successful: true,
+	}
+
+	silenced := st.apply(status)
+
+	assert.Equal(t, []transaction{{TransactionID: "tid_3", UUID: "1b7a1c6e-0d4f-4b5e-9e1a-3c0c8e7d9f20"}}, silenced.OpenTransactions)
+	assert.Equal(t, []silencedTransaction{
+		{transaction: status.OpenTransactions[0], SilenceID: byUUID.ID, SilencedBy: "jane.doe", SilenceComment: "test content", SilencedUntil: "2018-01-15T16:30:00Z"},
+		{transaction: status.OpenTransactions[1], SilenceID: byPattern.ID, SilencedBy: "john.doe", SilenceComment: "synthetic publishes", SilencedUntil: "2018-01-15T16:31:00Z"},
+	}, silenced.Silenced)
+
+	st.now = func() time.Time { return silenceNow.Add(3 * time.Hour) }
+	assert.Equal(t, status, st.apply(status), "the silences expired")
+}
+
+func TestDetermineHealthStatuses_Silences(t *testing.T) {
+
+	st := newSilenceStore(time.Hour)
+	s := &healthcheckerService{
+		source:         &fakeSource{txs: map[string]transactions{"annotations": {{TransactionID: "tid_1", UUID: "uuid_1"}, {TransactionID: "tid_2", UUID: "uuid_2"}}}},
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{},
+		silences:       st,
+	}
+	healthService := newHealthService(&healthConfig{}, s)
+
+	s.refreshHealthStatuses()
+	_, err := healthService.failedTransactionsChecker(annotationsConfig, 0)
+	assert.Error(t, err)
+
+	mustCreateSilence(t, st, `{"transaction_id":"tid_1","author":"jane.doe","comment":"test content","duration":"1h"}`)
+	s.refreshHealthStatuses()
+	_, err = healthService.failedTransactionsChecker(annotationsConfig, 0)
+	assert.NoError(t, err)
+
+	status := s.getContentTypeHealthStatus("annotations")
+	assert.Equal(t, []transaction{{TransactionID: "tid_2", UUID: "uuid_2"}}, status.OpenTransactions)
+	assert.Len(t, status.Silenced, 1)
+	assert.Equal(t, "tid_1", status.Silenced[0].TransactionID)
+
+	// the silenced failure is still open
+	s.refreshHealthStatuses()
+	status = s.getContentTypeHealthStatus("annotations")
+	assert.Empty(t, status.Resolved)
+	if assert.Len(t, status.Ongoing, 2) {
+		assert.Equal(t, "tid_1", status.Ongoing[0].TransactionID)
+		assert.Equal(t, 3, status.Ongoing[0].TimesSeen)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// slackNotifier posts the health changes as Block Kit messages, made of their rendered title and text, either to an incoming webhook or to the chat.postMessage API.
+// The API answers with the timestamp of the message, so the later messages of an incident are posted in its thread.
+// Incoming webhooks do not, so their messages are not threaded.
+type slackNotifier struct {
+	url         string
+	token       string
+	channel     string
+	detailsURL  string
+	maxFailures int
+	client      *http.Client
+	// timestamp of the first message of every ongoing incident, only used by the delivery goroutine of the notifier
+	threads map[string]string
+}
+
+type slackMessage struct {
+	Channel  string       `json:"channel,omitempty"`
+	Text     string       `json:"text"`
+	Blocks   []slackBlock `json:"blocks"`
+	ThreadTS string       `json:"thread_ts,omitempty"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// newSlackNotifier links /__details from the messages when the public address of the service is given.
+func newSlackNotifier(url string, token string, channel string, publicURL string, maxFailures int, client *http.Client) *slackNotifier {
+
+	n := &slackNotifier{url: url, token: token, channel: channel, maxFailures: maxFailures, client: client, threads: map[string]string{}}
+	if publicURL != "" {
+		n.detailsURL = detailsURL(publicURL)
+	}
+	return n
+}
+
+func (n *slackNotifier) destination() string {
+	return "Slack"
+}
+
+func (n *slackNotifier) notify(ctx context.Context, change healthChange) error {
+
+	message := n.message(change)
+	message.ThreadTS = n.threads[change.Incident]
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer cleanUp(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{statusCode: resp.StatusCode}
+	}
+
+	// incoming webhooks answer with a plain "ok", the API with a JSON object
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var answer slackResponse
+	if json.Unmarshal(b, &answer) == nil {
+		if !answer.OK {
+			return &slackError{code: answer.Error}
+		}
+		if message.ThreadTS == "" && answer.TS != "" {
+			n.threads[change.Incident] = answer.TS
+		}
+	}
+
+	if change.Event == changeRecovered || change.Event == changeReaderRecovered {
+		delete(n.threads, change.Incident)
+	}
+	return nil
+}
+
+// slackError is an answer of the Slack API refusing a message, with its error code.
+type slackError struct {
+	code string
+}
+
+func (e *slackError) Error() string {
+	return fmt.Sprintf("Slack refused the message: %s", e.code)
+}
+
+// permanent tells whether Slack would refuse the message again, e.g. channel_not_found or invalid_auth,
+// rather than failing to take it for the time being.
+func (e *slackError) permanent() bool {
+	switch e.code {
+	case "ratelimited", "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+		return false
+	default:
+		return true
+	}
+}
+
+func (n *slackNotifier) message(change healthChange) slackMessage {
+
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: change.Title}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: slackEscape(change.Text)}},
+	}
+	if change.Event == changeDegraded && len(change.FailedTransactions) > 0 {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: n.failures(change.FailedTransactions)}})
+	}
+
+	links := []string{fmt.Sprintf("<%s|Panic guide>", panicGuideURL)}
+	if n.detailsURL != "" {
+		links = append(links, fmt.Sprintf("<%s|Details>", n.detailsURL))
+	}
+	links = append(links, "Incident "+slackEscape(change.Incident))
+	blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: strings.Join(links, " | ")}}})
+
+	return slackMessage{Channel: n.channel, Text: change.Title, Blocks: blocks}
+}
+
+// failures lists the first failed transactions, and counts the others.
+func (n *slackNotifier) failures(txs []transaction) string {
+
+	lines := []string{"*Failed transactions:*"}
+	for i, tx := range txs {
+		if i == n.maxFailures {
+			lines = append(lines, fmt.Sprintf("and %d more", len(txs)-n.maxFailures))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("• `%s` (transaction `%s`)", slackEscape(tx.UUID), slackEscape(tx.TransactionID)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// slackEscape escapes the characters Slack uses for its markup, as required in the message texts.
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
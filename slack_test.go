@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// slackStandIn mimics chat.postMessage, or an incoming webhook when it is not an API.
+type slackStandIn struct {
+	api           bool
+	messages      []slackMessage
+	authorization []string
+	sync.Mutex
+}
+
+func (s *slackStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	var message slackMessage
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.messages = append(s.messages, message)
+	s.authorization = append(s.authorization, r.Header.Get("Authorization"))
+
+	if !s.api {
+		w.Write([]byte("ok"))
+		return
+	}
+	if message.Channel == "" {
+		w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+		return
+	}
+	fmt.Fprintf(w, `{"ok":true,"ts":"1516026600.%06d"}`, len(s.messages))
+}
+
+var (
+	degradedChange = healthChange{
+		Event:          changeDegraded,
+		ContentType:    "annotations",
+		Incident:       "annotations-degraded-20180115T143000Z",
+		Time:           "2018-01-15T14:30:00Z",
+		CheckingPeriod: "Between -15m and -5m",
+		FailureCount:   3,
+		Tier:           "warning",
+		Title:          "Annotations publish failures detected (warning)",
+		Summary:        "Annotations publish failures detected (warning). NO of failures: 3",
+		Text:           "*3* annotations publishes failed. Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m",
+		FailedTransactions: []transaction{
+			{TransactionID: "tid_a", UUID: "uuid_a"},
+			{TransactionID: "tid_b", UUID: "uuid_b"},
+			{TransactionID: "tid_<c>", UUID: "uuid_c"},
+		},
+	}
+	recoveredChange = healthChange{
+		Event:          changeRecovered,
+		ContentType:    "annotations",
+		Incident:       "annotations-degraded-20180115T143000Z",
+		Time:           "2018-01-15T14:35:00Z",
+		CheckingPeriod: "Between -15m and -5m",
+		Title:          "Annotations publishes recovered",
+		Summary:        "Annotations publishes recovered. NO of failures: 0",
+		Text:           "No degradation detected. NO of failures: 0. Latest check at: 2018-01-15T14:35:00Z\nBetween -15m and -5m",
+	}
+)
+
+func TestSlackNotifier_Message(t *testing.T) {
+
+	n := newSlackNotifier("http://localhost", "", "#alerts", "https://upp.example.com/__annotations-publish-healthchecker/", 2, http.DefaultClient)
+
+	message := n.message(degradedChange)
+
+	assert.Equal(t, "#alerts", message.Channel)
+	assert.Equal(t, "Annotations publish failures detected (warning)", message.Text)
+	assert.Equal(t, []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: "Annotations publish failures detected (warning)"}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*3* annotations publishes failed. Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m"}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*Failed transactions:*\n• `uuid_a` (transaction `tid_a`)\n• `uuid_b` (transaction `tid_b`)\nand 1 more"}},
+		{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: "<https://dewey.ft.com/annotations-publish-healthchecker.html|Panic guide> | " +
+			"<https://upp.example.com/__annotations-publish-healthchecker/__details|Details> | Incident annotations-degraded-20180115T143000Z"}}},
+	}, message.Blocks)
+
+	n.maxFailures = 10
+	assert.Contains(t, n.message(degradedChange).Blocks[2].Text.Text, "• `uuid_c` (transaction `tid_&lt;c&gt;`)")
+
+	message = n.message(recoveredChange)
+	assert.Equal(t, "Annotations publishes recovered", message.Text)
+	assert.Len(t, message.Blocks, 3)
+	assert.Equal(t, "<https://dewey.ft.com/annotations-publish-healthchecker.html|Panic guide> | <https://upp.example.com/__annotations-publish-healthchecker/__details|Details> | Incident annotations-degraded-20180115T143000Z", message.Blocks[2].Elements[0].Text)
+
+	n = newSlackNotifier("http://localhost", "", "", "", 2, http.DefaultClient)
+	message = n.message(healthChange{Event: changeReaderUnreachable, Incident: "annotations-unreachable-20180115T143000Z", Title: "Splunk Event Reader is not reachable for annotations", Text: "Latest check at: <now>"})
+	assert.Equal(t, "Splunk Event Reader is not reachable for annotations", message.Text)
+	assert.Equal(t, "Latest check at: &lt;now&gt;", message.Blocks[1].Text.Text)
+	assert.Equal(t, "<https://dewey.ft.com/annotations-publish-healthchecker.html|Panic guide> | Incident annotations-unreachable-20180115T143000Z", message.Blocks[2].Elements[0].Text)
+}
+
+func TestSlackNotifier_ThreadsPerIncident(t *testing.T) {
+
+	standIn := &slackStandIn{api: true}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	n := newSlackNotifier(server.URL, "xoxb-token", "#alerts", "", 10, http.DefaultClient)
+	critical := degradedChange
+	critical.Tier = "critical"
+	other := degradedChange
+	other.Incident = "annotations-degraded-20180115T150000Z"
+
+	for _, change := range []healthChange{degradedChange, critical, recoveredChange, other} {
+		assert.NoError(t, n.notify(context.Background(), change))
+	}
+
+	assert.Len(t, standIn.messages, 4)
+	assert.Equal(t, "", standIn.messages[0].ThreadTS)
+	assert.Equal(t, "1516026600.000001", standIn.messages[1].ThreadTS)
+	assert.Equal(t, "1516026600.000001", standIn.messages[2].ThreadTS)
+	assert.Equal(t, "", standIn.messages[3].ThreadTS)
+	assert.Equal(t, "Bearer xoxb-token", standIn.authorization[0])
+	assert.Equal(t, map[string]string{other.Incident: "1516026600.000004"}, n.threads)
+}
+
+func TestSlackNotifier_IncomingWebhook(t *testing.T) {
+
+	standIn := &slackStandIn{}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	n := newSlackNotifier(server.URL, "", "", "", 10, http.DefaultClient)
+	assert.NoError(t, n.notify(context.Background(), degradedChange))
+	assert.NoError(t, n.notify(context.Background(), recoveredChange))
+
+	assert.Len(t, standIn.messages, 2)
+	assert.Equal(t, "", standIn.messages[1].ThreadTS)
+	assert.Equal(t, "", standIn.authorization[0])
+}
+
+func TestSlackNotifier_Refused(t *testing.T) {
+
+	server := httptest.NewServer(&slackStandIn{api: true})
+	defer server.Close()
+
+	n := newSlackNotifier(server.URL, "xoxb-token", "", "", 10, http.DefaultClient)
+	err := n.notify(context.Background(), degradedChange)
+	assert.EqualError(t, err, "Slack refused the message: channel_not_found")
+	if r, ok := err.(refusal); assert.True(t, ok) {
+		assert.True(t, r.permanent(), "a message to a missing channel is refused for good")
+	}
+	assert.Empty(t, n.threads)
+
+	assert.False(t, (&slackError{code: "ratelimited"}).permanent())
+	assert.False(t, (&slackError{code: "service_unavailable"}).permanent())
+	assert.True(t, (&slackError{code: "invalid_auth"}).permanent())
+}
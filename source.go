@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// the sources of the open transactions
+const (
+	sourceEventReader = "event-reader"
+	sourceSplunk      = "splunk"
+	sourceEvents      = "events"
+)
+
+// TransactionSource supplies the open (not yet closed) publish transactions of a content type
+// that started between the earliest and the latest time.
+type TransactionSource interface {
+	FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error)
+}
+
+// fetchError tells why a source could not fetch the open transactions, so that the failures can be reported by reason.
+type fetchError struct {
+	reason     string
+	location   string
+	statusCode int
+	err        error
+}
+
+func (e *fetchError) Error() string {
+	if e.location == "" {
+		return fmt.Sprintf("failed to retrieve transactions: %v", e.err)
+	}
+	return fmt.Sprintf("failed to retrieve transactions from %s: %v", e.location, e.err)
+}
+
+func failureReasonOf(err error) string {
+	if fe, ok := err.(*fetchError); ok {
+		return fe.reason
+	}
+	return failureReasonUnknown
+}
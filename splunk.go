@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	splunkJobsPath = "/services/search/jobs"
+	// time given to cancel a search job, which happens once the check may have used up its own time
+	splunkCancelTimeout = 10 * time.Second
+	// defaultSplunkSearch groups the publish monitoring events into transactions, and keeps the ones without a PublishEnd event
+	defaultSplunkSearch = `search monitoring_event=true content_type="{{.ContentType}}" (event=PublishStart OR event=PublishEnd)` +
+		` | transaction transaction_id startswith=eval(event="PublishStart") endswith=eval(event="PublishEnd") keepevicted=true` +
+		` | where closed_txn=0 | table _time transaction_id uuid`
+)
+
+// splunkSearchData is given to the search templates.
+type splunkSearchData struct {
+	ContentType string
+}
+
+// splunkSource fetches the open transactions by running a search through the search jobs API of Splunk:
+// it creates a job, polls it until it is done, pages through its results and cancels it.
+// The search of every content type is rendered from a template, and should return the transaction_id, uuid and _time
+// (or start_time) fields of the open transactions.
+type splunkSource struct {
+	address      string
+	token        string
+	searches     map[string]string
+	pollInterval time.Duration
+	pageSize     int
+	client       *http.Client
+}
+
+type splunkJob struct {
+	SID string `json:"sid"`
+}
+
+type splunkJobStatus struct {
+	Entry []struct {
+		Content struct {
+			DispatchState string `json:"dispatchState"`
+			IsDone        bool   `json:"isDone"`
+			IsFailed      bool   `json:"isFailed"`
+			Messages      []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"messages"`
+		} `json:"content"`
+	} `json:"entry"`
+}
+
+type splunkResults struct {
+	Results []map[string]interface{} `json:"results"`
+}
+
+// newSplunkSource renders the search of every content type, from its own template or from the default one.
+func newSplunkSource(address string, token string, defaultSearch string, contentTypes []contentTypeConfig, pollInterval time.Duration, pageSize int, client *http.Client) (*splunkSource, error) {
+
+	searches := map[string]string{}
+	for _, ct := range contentTypes {
+		text := ct.SplunkSearch
+		if text == "" {
+			text = defaultSearch
+		}
+		search, err := renderSplunkSearch(text, ct.ContentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Splunk search of %s: %v", ct.ContentType, err)
+		}
+		searches[ct.ContentType] = search
+	}
+
+	return &splunkSource{address: strings.TrimSuffix(address, "/"), token: token, searches: searches, pollInterval: pollInterval, pageSize: pageSize, client: client}, nil
+}
+
+func renderSplunkSearch(text string, contentType string) (string, error) {
+
+	tmpl, err := template.New(contentType).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, splunkSearchData{ContentType: contentType}); err != nil {
+		return "", err
+	}
+
+	// the jobs API expects a search command, or a generating command
+	search := strings.TrimSpace(buf.String())
+	if search == "" {
+		return "", fmt.Errorf("the search is empty")
+	}
+	if !strings.HasPrefix(search, "search ") && !strings.HasPrefix(search, "|") {
+		search = "search " + search
+	}
+	return search, nil
+}
+
+func (s *splunkSource) FetchOpenTransactions(ctx context.Context, contentType string, earliestTime relativeTime, latestTime relativeTime) (transactions, error) {
+
+	search, found := s.searches[contentType]
+	if !found {
+		return nil, &fetchError{reason: failureReasonRequest, location: s.address, err: fmt.Errorf("no Splunk search is configured for %s", contentType)}
+	}
+
+	form := url.Values{}
+	form.Set("search", search)
+	form.Set("earliest_time", earliestTime.splunkValue())
+	form.Set("latest_time", latestTime.splunkValue())
+
+	var job splunkJob
+	if err := s.call(ctx, "POST", splunkJobsPath, form, &job); err != nil {
+		return nil, err
+	}
+	if job.SID == "" {
+		return nil, &fetchError{reason: failureReasonDecode, location: s.address + splunkJobsPath, err: fmt.Errorf("no search job id in the response")}
+	}
+	defer s.cancel(job.SID)
+
+	if err := s.wait(ctx, job.SID); err != nil {
+		return nil, err
+	}
+	return s.results(ctx, job.SID)
+}
+
+// wait polls the job until it is done, or the context ends.
+func (s *splunkSource) wait(ctx context.Context, sid string) error {
+
+	path := splunkJobsPath + "/" + url.PathEscape(sid)
+	for {
+		var status splunkJobStatus
+		if err := s.call(ctx, "GET", path, nil, &status); err != nil {
+			return err
+		}
+		if len(status.Entry) == 0 {
+			return &fetchError{reason: failureReasonDecode, location: s.address + path, err: fmt.Errorf("no search job status in the response")}
+		}
+
+		content := status.Entry[0].Content
+		if content.IsFailed || content.DispatchState == "FAILED" {
+			var messages []string
+			for _, m := range content.Messages {
+				messages = append(messages, fmt.Sprintf("%s: %s", m.Type, m.Text))
+			}
+			return &fetchError{reason: failureReasonSearch, location: s.address + path, err: fmt.Errorf("search job failed: %s", strings.Join(messages, "; "))}
+		}
+		if content.IsDone {
+			return nil
+		}
+
+		select {
+		case <-time.After(s.pollInterval):
+		case <-ctx.Done():
+			return &fetchError{reason: failureReasonTransport, location: s.address + path, err: fmt.Errorf("search job not done in time: %v", ctx.Err())}
+		}
+	}
+}
+
+// results pages through the results of the job.
+func (s *splunkSource) results(ctx context.Context, sid string) (transactions, error) {
+
+	path := splunkJobsPath + "/" + url.PathEscape(sid) + "/results"
+	txs := transactions{}
+	for offset := 0; ; offset += s.pageSize {
+		params := url.Values{}
+		params.Set("offset", fmt.Sprint(offset))
+		params.Set("count", fmt.Sprint(s.pageSize))
+
+		var page splunkResults
+		if err := s.call(ctx, "GET", path+"?"+params.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, result := range page.Results {
+			txs = append(txs, splunkTransaction(result))
+		}
+		if len(page.Results) < s.pageSize {
+			return txs, nil
+		}
+	}
+}
+
+// cancel deletes the job once its results are in, or no longer needed, so that it does not use the Splunk quota.
+func (s *splunkSource) cancel(sid string) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), splunkCancelTimeout)
+	defer cancel()
+
+	if err := s.call(ctx, "DELETE", splunkJobsPath+"/"+url.PathEscape(sid), nil, nil); err != nil {
+		logger.WithError(err).Warnf("Failed to cancel the Splunk search job %s", sid)
+	}
+}
+
+// call sends an authenticated request to the REST API, with the form in the body, and decodes the JSON response into v, unless it is nil.
+func (s *splunkSource) call(ctx context.Context, method string, path string, form url.Values, v interface{}) error {
+
+	location := s.address + path
+	req, err := http.NewRequest(method, location, strings.NewReader(form.Encode()))
+	if err != nil {
+		return &fetchError{reason: failureReasonRequest, location: s.address, err: err}
+	}
+	q := req.URL.Query()
+	q.Set("output_mode", "json")
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return &fetchError{reason: failureReasonTransport, location: location, err: err}
+	}
+	defer cleanUp(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &fetchError{reason: failureReasonStatus, location: location, statusCode: resp.StatusCode, err: fmt.Errorf("unexpected status code %d", resp.StatusCode)}
+	}
+	if v == nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &fetchError{reason: failureReasonRead, location: location, err: err}
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return &fetchError{reason: failureReasonDecode, location: location, err: err}
+	}
+	return nil
+}
+
+// splunkTransaction maps a search result to a transaction. Multivalue fields keep their first value,
+// and the start time is normalised to the format of the splunk-event-reader when it can be parsed.
+func splunkTransaction(result map[string]interface{}) transaction {
+
+	startTime := splunkField(result, "start_time")
+	if startTime == "" {
+		startTime = splunkField(result, "_time")
+	}
+	if t, err := time.Parse(time.RFC3339Nano, startTime); err == nil {
+		startTime = t.UTC().Format(timestampFormat)
+	}
+
+	return transaction{TransactionID: splunkField(result, "transaction_id"), UUID: splunkField(result, "uuid"), LastModified: startTime}
+}
+
+func splunkField(result map[string]interface{}, name string) string {
+	switch value := result[name].(type) {
+	case string:
+		return value
+	case []interface{}:
+		if len(value) > 0 {
+			return fmt.Sprint(value[0])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// splunkStandIn mimics the search jobs API of Splunk: jobs are done after a number of polls, and their results are paged.
+type splunkStandIn struct {
+	token       string
+	pollsToDone int
+	failJob     bool
+	results     []map[string]interface{}
+	searches    []searchRequest
+	polls       int
+	pages       []string
+	deleted     []string
+	sync.Mutex
+}
+
+type searchRequest struct {
+	search       string
+	earliestTime string
+	latestTime   string
+}
+
+func (s *splunkStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("output_mode") != "json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, splunkJobsPath)
+	switch {
+	case r.Method == "POST" && path == "":
+		r.ParseForm()
+		s.searches = append(s.searches, searchRequest{search: r.PostForm.Get("search"), earliestTime: r.PostForm.Get("earliest_time"), latestTime: r.PostForm.Get("latest_time")})
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sid":"job_%d"}`, len(s.searches))
+	case r.Method == "GET" && strings.HasSuffix(path, "/results"):
+		s.pages = append(s.pages, r.URL.Query().Get("offset")+"+"+r.URL.Query().Get("count"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		page := []map[string]interface{}{}
+		for i := offset; i < offset+count && i < len(s.results); i++ {
+			page = append(page, s.results[i])
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": page})
+	case r.Method == "GET":
+		s.polls++
+		content := map[string]interface{}{"dispatchState": "RUNNING", "isDone": false, "isFailed": false}
+		if s.failJob {
+			content = map[string]interface{}{"dispatchState": "FAILED", "isDone": true, "isFailed": true, "messages": []map[string]string{{"type": "FATAL", "text": "Unknown search command 'tranzaction'."}}}
+		} else if s.polls >= s.pollsToDone {
+			content = map[string]interface{}{"dispatchState": "DONE", "isDone": true, "isFailed": false}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"entry": []interface{}{map[string]interface{}{"content": content}}})
+	case r.Method == "DELETE":
+		s.deleted = append(s.deleted, strings.TrimPrefix(path, "/"))
+		w.Write([]byte(`{"messages":[]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestSplunkSource(t *testing.T, address string, pageSize int) *splunkSource {
+
+	lists := contentTypeConfig{ContentType: "lists", SplunkSearch: `index=lists event=PublishStart content="{{.ContentType}}"`}
+	source, err := newSplunkSource(address, "secret", defaultSplunkSearch, []contentTypeConfig{annotationsConfig, lists}, time.Millisecond, pageSize, http.DefaultClient)
+	assert.NoError(t, err)
+	return source
+}
+
+func TestSplunkSource_FetchesTheResultsOfASearchJob(t *testing.T) {
+
+	standIn := &splunkStandIn{
+		token:       "secret",
+		pollsToDone: 3,
+		results: []map[string]interface{}{
+			{"_time": "2018-01-15T14:00:00.123+01:00", "transaction_id": "tid_1", "uuid": "uuid_1"},
+			{"_time": "2018-01-15T14:01:00.000+00:00", "transaction_id": "tid_2", "uuid": []interface{}{"uuid_2", "uuid_2b"}},
+			{"start_time": "not a time", "transaction_id": "tid_3", "uuid": "uuid_3"},
+		},
+	}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	source := newTestSplunkSource(t, server.URL+"/", 2)
+	txs, err := source.FetchOpenTransactions(context.Background(), "annotations", annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, transactions{
+		{TransactionID: "tid_1", UUID: "uuid_1", LastModified: "2018-01-15T13:00:00.123Z"},
+		{TransactionID: "tid_2", UUID: "uuid_2", LastModified: "2018-01-15T14:01:00Z"},
+		{TransactionID: "tid_3", UUID: "uuid_3", LastModified: "not a time"},
+	}, txs)
+
+	assert.Equal(t, []searchRequest{{search: strings.Replace(defaultSplunkSearch, "{{.ContentType}}", "annotations", 1), earliestTime: "-15m", latestTime: "-5m"}}, standIn.searches)
+	assert.Equal(t, 3, standIn.polls)
+	assert.Equal(t, []string{"0+2", "2+2"}, standIn.pages)
+	assert.Equal(t, []string{"job_1"}, standIn.deleted)
+}
+
+func TestSplunkSource_UsesTheSearchOfTheContentType(t *testing.T) {
+
+	standIn := &splunkStandIn{token: "secret", pollsToDone: 1}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	source := newTestSplunkSource(t, server.URL, 100)
+	earliest := absoluteTime(time.Date(2018, 1, 15, 14, 0, 0, 0, time.UTC))
+	latest := absoluteTime(time.Date(2018, 1, 15, 14, 30, 0, 0, time.UTC))
+	txs, err := source.FetchOpenTransactions(context.Background(), "lists", earliest, latest)
+
+	assert.NoError(t, err)
+	assert.Equal(t, transactions{}, txs)
+	assert.Equal(t, []searchRequest{{search: `search index=lists event=PublishStart content="lists"`, earliestTime: "1516024800", latestTime: "1516026600"}}, standIn.searches)
+	assert.Equal(t, []string{"0+100"}, standIn.pages)
+}
+
+func TestSplunkSource_Errors(t *testing.T) {
+
+	standIn := &splunkStandIn{token: "secret", failJob: true}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	var tests = []struct {
+		scenario    string
+		source      *splunkSource
+		contentType string
+		reason      string
+		err         string
+	}{
+		{"Failed search job", newTestSplunkSource(t, server.URL, 100), "annotations", failureReasonSearch, "search job failed: FATAL: Unknown search command 'tranzaction'."},
+		{"Wrong token", &splunkSource{address: server.URL, token: "wrong", searches: map[string]string{"annotations": "search *"}, client: http.DefaultClient}, "annotations", failureReasonStatus, "unexpected status code 401"},
+		{"Unknown content type", newTestSplunkSource(t, server.URL, 100), "pages", failureReasonRequest, "no Splunk search is configured for pages"},
+		{"No response", newTestSplunkSource(t, "http://localhost:8080", 100), "annotations", failureReasonTransport, "connection refused"},
+	}
+
+	for _, test := range tests {
+		txs, err := test.source.FetchOpenTransactions(context.Background(), test.contentType, annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+
+		assert.Nil(t, txs, test.scenario)
+		assert.Equal(t, test.reason, failureReasonOf(err), test.scenario)
+		if assert.Error(t, err, test.scenario) {
+			assert.Contains(t, err.Error(), test.err, test.scenario)
+		}
+	}
+	// the failed job is cleaned up all the same
+	assert.Equal(t, []string{"job_1"}, standIn.deleted)
+}
+
+func TestSplunkSource_GivesUpWhenTheJobIsNotDoneInTime(t *testing.T) {
+
+	standIn := &splunkStandIn{token: "secret", pollsToDone: 1000000}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := newTestSplunkSource(t, server.URL, 100).FetchOpenTransactions(ctx, "annotations", annotationsConfig.EarliestTime, annotationsConfig.LatestTime)
+
+	// not done in time is worth retrying, like a timeout
+	assert.True(t, isRetryable(err))
+	assert.Contains(t, err.Error(), "/services/search/jobs/job_1")
+	assert.Equal(t, []string{"job_1"}, standIn.deleted)
+}
+
+func TestRenderSplunkSearch(t *testing.T) {
+
+	search, err := renderSplunkSearch(`| inputlookup {{.ContentType}}_transactions`, "lists")
+	assert.NoError(t, err)
+	assert.Equal(t, "| inputlookup lists_transactions", search)
+
+	search, err = renderSplunkSearch(`index=main content_type={{.ContentType}}`, "lists")
+	assert.NoError(t, err)
+	assert.Equal(t, "search index=main content_type=lists", search)
+
+	_, err = renderSplunkSearch(`index=main content_type={{.ContentType`, "lists")
+	assert.Error(t, err)
+
+	_, err = renderSplunkSearch(`index=main content_type={{.Content}}`, "lists")
+	assert.Error(t, err)
+
+	_, err = renderSplunkSearch(` `, "lists")
+	assert.EqualError(t, err, "the search is empty")
+
+	_, err = newSplunkSource("http://localhost:8089", "secret", "{{.Unknown}}", []contentTypeConfig{annotationsConfig}, time.Millisecond, 100, http.DefaultClient)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid Splunk search of annotations")
+}
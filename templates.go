@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Financial-Times/go-logger"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// the templates rendering the texts of the checks and of the notifications
+const (
+	templateTechnicalSummary    = "technicalSummary"
+	templateCheckOutput         = "checkOutput"
+	templateNotificationTitle   = "notificationTitle"
+	templateNotificationText    = "notificationText"
+	templateNotificationSummary = "notificationSummary"
+
+	templateReachabilityTechnicalSummary = "reachabilityTechnicalSummary"
+	templateReachabilityOutput           = "reachabilityOutput"
+	templateFreshnessTechnicalSummary    = "freshnessTechnicalSummary"
+	templateFreshnessOutput              = "freshnessOutput"
+)
+
+// defaultTemplates keep the wording the texts had before they could be templated.
+const defaultTemplates = `
+{{- define "technicalSummary" -}}
+{{.DisplayName}} publishes failed{{describeTier .Tier}}. There is a degradation in the {{.ContentType}} publish or monitoring services. Check the /__details endpoint.
+{{- end}}
+
+{{- define "checkOutput" -}}
+{{if .Degraded}}Degradation detected{{describeTier .Tier}}. {{else}}No degradation detected. {{end}}NO of failures: {{.FailureCount}}. Latest check at: {{.CheckingTime}}
+{{- end}}
+
+{{- define "notificationTitle" -}}
+{{if eq .Event "degraded"}}{{.DisplayName}} publish failures detected{{with .Tier.Name}} ({{.}}){{end}}
+{{- else if eq .Event "recovered"}}{{.DisplayName}} publishes recovered
+{{- else if eq .Event "reader_unreachable"}}Splunk Event Reader is not reachable for {{.ContentType}}
+{{- else}}Splunk Event Reader is reachable again for {{.ContentType}}{{end}}
+{{- end}}
+
+{{- define "notificationSummary" -}}
+{{template "notificationTitle" .}}. NO of failures: {{.FailureCount}}
+{{- end}}
+
+{{- define "notificationText" -}}
+{{if eq .Event "degraded"}}*{{.FailureCount}}* {{.ContentType}} publishes failed. Latest check at: {{.CheckingTime}}
+{{- else if eq .Event "recovered"}}No degradation detected. NO of failures: {{.FailureCount}}. Latest check at: {{.CheckingTime}}
+{{- else if eq .Event "reader_unreachable"}}The publish failures of {{.ContentType}} are not known. Latest check at: {{.CheckingTime}}
+{{- with .Status.Error}}
+` + "```{{.}}```" + `
+{{- end}}
+{{- else}}Latest check at: {{.CheckingTime}}{{end}}
+{{- with .CheckingPeriod}}
+{{.}}
+{{- end}}
+{{- end}}
+
+{{- define "reachabilityTechnicalSummary" -}}
+This check verifies whether the calls to the splunk-event-reader are successful for every monitored content type, hence the results are relevant. It fails only after a number of consecutive failed checks, and recovers after a number of consecutive successful ones.
+{{- end}}
+
+{{- define "reachabilityOutput" -}}
+{{if .Unreachable}}Splunk Event Reader was not reachable for {{join .Unreachable ", "}}{{else}}Splunk Event Reader was reachable{{end}}. Latest check at: {{.CheckingTime}}
+{{- if or .Streaks .Breaker}}.{{with .Streaks}} {{.}}{{end}}{{with .Breaker}} {{.}}{{end}}{{end}}
+{{- end}}
+
+{{- define "freshnessTechnicalSummary" -}}
+This check verifies whether the health of every monitored content type was determined recently. If not, the monitoring loop has stopped or hangs, and the service should be restarted.
+{{- end}}
+
+{{- define "freshnessOutput" -}}
+{{if .Stale}}Health data is stale for {{join .Stale ", "}}{{else}}Health data is fresh{{end}}. Results older than {{.StaleAfter}} are considered stale.
+{{- end}}
+`
+
+var (
+	defaultAlertTemplates = mustParseAlertTemplates("", "", "")
+	// time of the sample context validating the templates
+	sampleTime = time.Date(2018, 1, 15, 14, 30, 0, 0, time.UTC)
+)
+
+// templateContext is given to the templates. The technical summaries are rendered once at startup, so they get no status.
+// The texts of the reachability and freshness checks cover every content type, they get the lists of the failing ones instead.
+type templateContext struct {
+	Event          string
+	ContentType    string
+	DisplayName    string
+	Incident       string
+	Tier           failureTier
+	Degraded       bool
+	Status         healthStatus
+	FailureCount   int
+	CheckingPeriod string
+	CheckingTime   string
+	Environment    string
+	PanicGuideURL  string
+	DetailsURL     string
+	Unreachable    []string
+	Streaks        string
+	Breaker        string
+	Stale          []string
+	StaleAfter     string
+}
+
+// alertTemplates renders the texts of the checks and of the notifications from the built-in templates,
+// or from the ones redefined by the user.
+type alertTemplates struct {
+	templates   *template.Template
+	environment string
+	detailsURL  string
+}
+
+// loadAlertTemplates parses the templates of the given file on top of the built-in ones. An empty path keeps the built-in ones.
+func loadAlertTemplates(path string, environment string, publicURL string) (*alertTemplates, error) {
+
+	text := ""
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return parseAlertTemplates(text, environment, publicURL)
+}
+
+// parseAlertTemplates parses the given templates on top of the built-in ones, and validates them all by rendering them against a sample context.
+func parseAlertTemplates(text string, environment string, publicURL string) (*alertTemplates, error) {
+
+	templates, err := template.New("alerts").Funcs(template.FuncMap{"describeTier": failureTier.describe, "join": strings.Join}).Parse(defaultTemplates)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := templates.Parse(text); err != nil {
+		return nil, err
+	}
+
+	t := &alertTemplates{templates: templates, environment: environment}
+	if publicURL != "" {
+		t.detailsURL = detailsURL(publicURL)
+	}
+
+	for _, event := range []string{changeDegraded, changeRecovered, changeReaderUnreachable, changeReaderRecovered} {
+		sample := t.context(sampleChange(event))
+		for _, name := range []string{templateTechnicalSummary, templateCheckOutput, templateNotificationTitle, templateNotificationText, templateNotificationSummary} {
+			if _, err := t.execute(name, sample); err != nil {
+				return nil, fmt.Errorf("template %s cannot be rendered: %v", name, err)
+			}
+		}
+	}
+
+	// the checks of all the content types, when they pass and when they fail
+	for _, sample := range []templateContext{
+		t.reachabilityContext(nil, sampleTime.Format(timestampFormat), "", ""),
+		t.reachabilityContext([]string{"annotations"}, sampleTime.Format(timestampFormat), "Consecutive checks: annotations 3 failed (unreachable after 3 failed, reachable again after 2 successful).", "Circuit breaker is closed with 3 consecutive failures."),
+		t.freshnessContext(nil, 3*time.Minute),
+		t.freshnessContext([]string{"annotations (never checked)"}, 3*time.Minute),
+	} {
+		for _, name := range []string{templateReachabilityTechnicalSummary, templateReachabilityOutput, templateFreshnessTechnicalSummary, templateFreshnessOutput} {
+			if _, err := t.execute(name, sample); err != nil {
+				return nil, fmt.Errorf("template %s cannot be rendered: %v", name, err)
+			}
+		}
+	}
+	return t, nil
+}
+
+// sampleChange is a change of the given kind, filled in to exercise the templates.
+func sampleChange(event string) healthChange {
+	return healthChange{
+		Event:       event,
+		ContentType: "annotations",
+		Incident:    incidentID("annotations", "degraded", sampleTime),
+		status: healthStatus{
+			OpenTransactions: []transaction{{TransactionID: "tid_sample", UUID: "9a5e3b4a-55da-498d-8b79-1f5b0ec4eb23", LastModified: sampleTime.Format(timestampFormat)}},
+			CheckingPeriod:   "Between -15m and -5m",
+			LastTimeCheck:    sampleTime.Format(timestampFormat),
+			Successful:       true,
+			Reachable:        true,
+			Error:            "unexpected status code 503",
+		},
+		tier: failureTier{Name: "critical", Threshold: 1, Severity: 1},
+	}
+}
+
+func mustParseAlertTemplates(text string, environment string, publicURL string) *alertTemplates {
+	t, err := parseAlertTemplates(text, environment, publicURL)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// render renders a template, falling back to the built-in one if the template of the user fails.
+func (t *alertTemplates) render(name string, ctx templateContext) string {
+
+	text, err := t.execute(name, ctx)
+	if err == nil {
+		return text
+	}
+	logger.WithError(err).Warnf("Failed to render the %s template, using the built-in one", name)
+	text, err = defaultAlertTemplates.execute(name, ctx)
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to render the built-in %s template", name)
+	}
+	return text
+}
+
+func (t *alertTemplates) execute(name string, ctx templateContext) (string, error) {
+
+	buf := &bytes.Buffer{}
+	if err := t.templates.ExecuteTemplate(buf, name, ctx); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// checkContext is the context of the texts of a check, for the given tier.
+func (t *alertTemplates) checkContext(ct contentTypeConfig, tier failureTier, degraded bool, status healthStatus) templateContext {
+	return templateContext{
+		ContentType:    ct.ContentType,
+		DisplayName:    displayName(ct.ContentType),
+		Tier:           tier,
+		Degraded:       degraded,
+		Status:         status,
+		FailureCount:   len(status.OpenTransactions),
+		CheckingPeriod: status.CheckingPeriod,
+		CheckingTime:   status.LastTimeCheck,
+		Environment:    t.environment,
+		PanicGuideURL:  panicGuideURL,
+		DetailsURL:     t.detailsURL,
+	}
+}
+
+// reachabilityContext is the context of the texts of the reachability check, listing the content types the event reader is unreachable for.
+func (t *alertTemplates) reachabilityContext(unreachable []string, checkingTime string, streaks string, breaker string) templateContext {
+	return templateContext{
+		Degraded:      len(unreachable) > 0,
+		CheckingTime:  checkingTime,
+		Environment:   t.environment,
+		PanicGuideURL: panicGuideURL,
+		DetailsURL:    t.detailsURL,
+		Unreachable:   unreachable,
+		Streaks:       streaks,
+		Breaker:       breaker,
+	}
+}
+
+// freshnessContext is the context of the texts of the freshness check, listing the content types whose results are stale.
+func (t *alertTemplates) freshnessContext(stale []string, staleAfter time.Duration) templateContext {
+	return templateContext{
+		Degraded:      len(stale) > 0,
+		Environment:   t.environment,
+		PanicGuideURL: panicGuideURL,
+		DetailsURL:    t.detailsURL,
+		Stale:         stale,
+		StaleAfter:    staleAfter.String(),
+	}
+}
+
+// context is the context of the texts of a notification.
+func (t *alertTemplates) context(change healthChange) templateContext {
+
+	ctx := t.checkContext(contentTypeConfig{ContentType: change.ContentType}, change.tier, change.Event == changeDegraded, change.status)
+	ctx.Event = change.Event
+	ctx.Incident = change.Incident
+	return ctx
+}
+
+// describe renders the texts of a notification.
+func (t *alertTemplates) describe(change healthChange) healthChange {
+
+	ctx := t.context(change)
+	change.Title = t.render(templateNotificationTitle, ctx)
+	change.Summary = t.render(templateNotificationSummary, ctx)
+	change.Text = t.render(templateNotificationText, ctx)
+	return change
+}
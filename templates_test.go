@@ -0,0 +1,138 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAlertTemplates_Defaults(t *testing.T) {
+
+	var tests = []struct {
+		event           string
+		expectedTitle   string
+		expectedSummary string
+		expectedText    string
+	}{
+		{
+			event:           changeDegraded,
+			expectedTitle:   "Annotations publish failures detected (critical)",
+			expectedSummary: "Annotations publish failures detected (critical). NO of failures: 1",
+			expectedText:    "*1* annotations publishes failed. Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m",
+		},
+		{
+			event:           changeRecovered,
+			expectedTitle:   "Annotations publishes recovered",
+			expectedSummary: "Annotations publishes recovered. NO of failures: 1",
+			expectedText:    "No degradation detected. NO of failures: 1. Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m",
+		},
+		{
+			event:           changeReaderUnreachable,
+			expectedTitle:   "Splunk Event Reader is not reachable for annotations",
+			expectedSummary: "Splunk Event Reader is not reachable for annotations. NO of failures: 1",
+			expectedText:    "The publish failures of annotations are not known. Latest check at: 2018-01-15T14:30:00Z\n```unexpected status code 503```\nBetween -15m and -5m",
+		},
+		{
+			event:           changeReaderRecovered,
+			expectedTitle:   "Splunk Event Reader is reachable again for annotations",
+			expectedSummary: "Splunk Event Reader is reachable again for annotations. NO of failures: 1",
+			expectedText:    "Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m",
+		},
+	}
+
+	for _, test := range tests {
+		change := defaultAlertTemplates.describe(sampleChange(test.event))
+		assert.Equal(t, test.expectedTitle, change.Title, test.event)
+		assert.Equal(t, test.expectedSummary, change.Summary, test.event)
+		assert.Equal(t, test.expectedText, change.Text, test.event)
+	}
+
+	ctx := defaultAlertTemplates.checkContext(annotationsConfig, failureTier{Name: "warning", Threshold: 1, Severity: 2}, false, healthStatus{})
+	assert.Equal(t, "Annotations publishes failed (warning tier: at least 1 failures, severity 2). There is a degradation in the annotations publish or monitoring services. Check the /__details endpoint.",
+		defaultAlertTemplates.render(templateTechnicalSummary, ctx))
+
+	assert.Equal(t, "Splunk Event Reader was reachable. Latest check at: 2018-01-15T14:30:00Z",
+		defaultAlertTemplates.render(templateReachabilityOutput, defaultAlertTemplates.reachabilityContext(nil, "2018-01-15T14:30:00Z", "", "")))
+	assert.Equal(t, "Splunk Event Reader was not reachable for annotations, lists. Latest check at: 2018-01-15T14:30:00Z. Circuit breaker is closed with 3 consecutive failures.",
+		defaultAlertTemplates.render(templateReachabilityOutput, defaultAlertTemplates.reachabilityContext([]string{"annotations", "lists"}, "2018-01-15T14:30:00Z", "", "Circuit breaker is closed with 3 consecutive failures.")))
+	assert.Equal(t, "Health data is stale for annotations (never checked). Results older than 3m0s are considered stale.",
+		defaultAlertTemplates.render(templateFreshnessOutput, defaultAlertTemplates.freshnessContext([]string{"annotations (never checked)"}, 3*time.Minute)))
+}
+
+func TestAlertTemplates_Custom(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "alerts.tmpl")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+{{define "notificationTitle"}}[{{.Environment}}] {{.ContentType}} {{.Event}}{{end}}
+{{define "checkOutput"}}{{.FailureCount}} failures, see {{.DetailsURL}} and {{.PanicGuideURL}}{{end}}
+{{define "reachabilityTechnicalSummary"}}Calls to the splunk-event-reader in {{.Environment}}.{{end}}
+{{define "reachabilityOutput"}}[{{.Environment}}] unreachable for {{len .Unreachable}} content type(s){{end}}
+{{define "freshnessOutput"}}[{{.Environment}}] stale: {{join .Stale "; "}}{{end}}
+`), 0644))
+
+	templates, err := loadAlertTemplates(path, "prod-eu", "https://upp.example.com/__annotations-publish-healthchecker")
+	assert.NoError(t, err)
+
+	change := templates.describe(sampleChange(changeDegraded))
+	assert.Equal(t, "[prod-eu] annotations degraded", change.Title)
+	assert.Equal(t, "[prod-eu] annotations degraded. NO of failures: 1", change.Summary)
+	assert.Equal(t, "*1* annotations publishes failed. Latest check at: 2018-01-15T14:30:00Z\nBetween -15m and -5m", change.Text)
+
+	healthService := newHealthService(&healthConfig{}, &healthcheckerService{
+		contentTypes:   []contentTypeConfig{annotationsConfig},
+		healthStatuses: map[string]healthStatus{"annotations": {OpenTransactions: testTxs, Successful: true}},
+		staleAfter:     3 * time.Minute,
+		templates:      templates,
+	})
+	_, err = healthService.failedTransactionsChecker(annotationsConfig, 0)
+	assert.EqualError(t, err, "2 failures, see https://upp.example.com/__annotations-publish-healthchecker/__details and https://dewey.ft.com/annotations-publish-healthchecker.html")
+	assert.Equal(t, "Annotations publishes failed. There is a degradation in the annotations publish or monitoring services. Check the /__details endpoint.", healthService.checks[2].TechnicalSummary)
+
+	assert.Equal(t, "Calls to the splunk-event-reader in prod-eu.", healthService.checks[0].TechnicalSummary)
+	_, err = healthService.eventReaderIsReachable()
+	assert.EqualError(t, err, "[prod-eu] unreachable for 1 content type(s)")
+	assert.Contains(t, healthService.checks[1].TechnicalSummary, "the monitoring loop has stopped or hangs")
+	_, err = healthService.healthDataIsFresh()
+	assert.EqualError(t, err, "[prod-eu] stale: annotations (never checked)")
+}
+
+func TestAlertTemplates_Invalid(t *testing.T) {
+
+	var tests = []struct {
+		text        string
+		expectedErr string
+	}{
+		{`{{define "checkOutput"}}{{.FailureCount}`, "template: alerts:1: "},
+		{`{{define "checkOutput"}}{{.Failures}}{{end}}`, "template checkOutput cannot be rendered: "},
+		{`{{define "notificationText"}}{{if eq .Event "reader_recovered"}}{{.Status.Failures}}{{end}}{{end}}`, "template notificationText cannot be rendered: "},
+		{`{{define "reachabilityOutput"}}{{index .Unreachable 0}}{{end}}`, "template reachabilityOutput cannot be rendered: "},
+		{`{{define "freshnessOutput"}}{{.StaleAfter.Minutes}}{{end}}`, "template freshnessOutput cannot be rendered: "},
+	}
+
+	for _, test := range tests {
+		_, err := parseAlertTemplates(test.text, "", "")
+		if assert.Error(t, err, test.text) {
+			assert.Contains(t, err.Error(), test.expectedErr, test.text)
+		}
+	}
+
+	_, err := loadAlertTemplates("does-not-exist.tmpl", "", "")
+	assert.Error(t, err)
+}
+
+func TestAlertTemplates_FallsBackToTheBuiltInOnes(t *testing.T) {
+
+	templates, err := parseAlertTemplates(`{{define "notificationTitle"}}First failure: {{(index .Status.OpenTransactions 0).UUID}}{{end}}`, "", "")
+	assert.NoError(t, err)
+
+	change := sampleChange(changeRecovered)
+	change.status.OpenTransactions = nil
+	assert.Equal(t, "Annotations publishes recovered", templates.describe(change).Title)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webhookConfig is a destination of the health changes, the timeout is given in seconds.
+type webhookConfig struct {
+	URL     string `json:"url"`
+	Timeout int    `json:"timeout"`
+}
+
+// webhookNotifier posts the health changes as JSON to a URL. Any response other than a 2xx is a failure.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// parseWebhooks reads the JSON list of webhooks. Missing timeouts fall back to the given default.
+func parseWebhooks(value string, defaultTimeout time.Duration) ([]notifier, error) {
+
+	if value == "" {
+		return nil, nil
+	}
+
+	var configs []webhookConfig
+	if err := json.Unmarshal([]byte(value), &configs); err != nil {
+		return nil, fmt.Errorf("webhooks configuration is not valid JSON: %v", err)
+	}
+
+	var notifiers []notifier
+	for i, config := range configs {
+		u, err := url.Parse(config.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook at position %d should have an http or https URL", i)
+		}
+		if config.Timeout < 0 {
+			return nil, fmt.Errorf("webhook %s has a negative timeout", u.Host)
+		}
+
+		timeout := defaultTimeout
+		if config.Timeout > 0 {
+			timeout = time.Duration(config.Timeout) * time.Second
+		}
+		notifiers = append(notifiers, &webhookNotifier{url: config.URL, client: &http.Client{Timeout: timeout}})
+	}
+	return notifiers, nil
+}
+
+// destination names the webhook by its host, the rest of the URL may hold a secret.
+func (n *webhookNotifier) destination() string {
+	if u, err := url.Parse(n.url); err == nil {
+		return "webhook " + u.Host
+	}
+	return "webhook"
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, change healthChange) error {
+
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, body)
+}
+
+// statusError is a response of a destination other than a 2xx.
+type statusError struct {
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.statusCode)
+}
+
+// permanent tells whether sending the same notification again would get the same answer, as for any 4xx but a 429.
+func (e *statusError) permanent() bool {
+	return e.statusCode >= 400 && e.statusCode < 500 && e.statusCode != http.StatusTooManyRequests
+}
+
+// postJSON posts the body and fails on any response other than a 2xx.
+func postJSON(ctx context.Context, client *http.Client, location string, body []byte) error {
+
+	req, err := http.NewRequest("POST", location, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer cleanUp(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{statusCode: resp.StatusCode}
+	}
+	return nil
+}
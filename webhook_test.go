@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseWebhooks(t *testing.T) {
+
+	notifiers, err := parseWebhooks(`[{"url":"https://alerts.example.com/hook/secret"},{"url":"http://localhost:9000/hook","timeout":10}]`, 5*time.Second)
+
+	assert.NoError(t, err)
+	assert.Len(t, notifiers, 2)
+	assert.Equal(t, "webhook alerts.example.com", notifiers[0].destination())
+	assert.Equal(t, 5*time.Second, notifiers[0].(*webhookNotifier).client.Timeout)
+	assert.Equal(t, 10*time.Second, notifiers[1].(*webhookNotifier).client.Timeout)
+
+	notifiers, err = parseWebhooks("", 5*time.Second)
+	assert.NoError(t, err)
+	assert.Empty(t, notifiers)
+}
+
+func TestParseWebhooks_Invalid(t *testing.T) {
+
+	var tests = []struct {
+		value       string
+		expectedErr string
+	}{
+		{`{"url":"https://alerts.example.com"}`, "webhooks configuration is not valid JSON: json: cannot unmarshal object into Go value of type []main.webhookConfig"},
+		{`[{"timeout":5}]`, "webhook at position 0 should have an http or https URL"},
+		{`[{"url":"ftp://alerts.example.com"}]`, "webhook at position 0 should have an http or https URL"},
+		{`[{"url":"https://alerts.example.com","timeout":-1}]`, "webhook alerts.example.com has a negative timeout"},
+	}
+
+	for _, test := range tests {
+		_, err := parseWebhooks(test.value, 5*time.Second)
+		assert.EqualError(t, err, test.expectedErr, test.value)
+	}
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+
+	var received healthChange
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	change := healthChange{
+		Event:              changeDegraded,
+		ContentType:        "annotations",
+		Incident:           "annotations-degraded-20180115T143000Z",
+		FailureCount:       1,
+		FailedTransactions: []transaction{{TransactionID: "tid_a", UUID: "uuid_a"}},
+	}
+	n := &webhookNotifier{url: server.URL, client: http.DefaultClient}
+
+	assert.NoError(t, n.notify(context.Background(), change))
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, change, received)
+}
+
+func TestWebhookNotifier_Failures(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	n := &webhookNotifier{url: server.URL, client: http.DefaultClient}
+	assert.EqualError(t, n.notify(context.Background(), healthChange{}), "unexpected status code 503")
+
+	n = &webhookNotifier{url: server.URL + "/slow", client: &http.Client{Timeout: 10 * time.Millisecond}}
+	assert.Error(t, n.notify(context.Background(), healthChange{}))
+}
+
+func TestStatusError_Permanent(t *testing.T) {
+
+	tests := []struct {
+		statusCode int
+		permanent  bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusForbidden, true},
+		{http.StatusNotFound, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.permanent, (&statusError{statusCode: test.statusCode}).permanent(), "status code %d", test.statusCode)
+	}
+}